@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is time.Duration written as string such as "60s",
+// number is treated as seconds.
+type Duration time.Duration
+
+// MarshalText returns text of d
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalJSON decodes string or number of seconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if e := json.Unmarshal(b, &v); e != nil {
+		return e
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		t, e := time.ParseDuration(v)
+		if e != nil {
+			return e
+		}
+		*d = Duration(t)
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package config loads configuration and scenario files
+// written in JSON or subset of YAML.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Load decodes the JSON or YAML file p to v.
+// The file is decoded as JSON if the extension is .json.
+func Load(p string, v interface{}) error {
+	b, e := ioutil.ReadFile(p)
+	if e != nil {
+		return e
+	}
+	if strings.ToLower(filepath.Ext(p)) != ".json" {
+		y, e := ParseYAML(b)
+		if e != nil {
+			return e
+		}
+		if b, e = json.Marshal(y); e != nil {
+			return e
+		}
+	}
+	// numbers are decoded as json.Number in interface{} for 64-bit IDs
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if e := d.Decode(v); e != nil {
+		return e
+	}
+	if _, e := d.Token(); e != io.EOF {
+		return fmt.Errorf("invalid data after top-level value")
+	}
+	return nil
+}
+
+// ParseYAML decodes subset of YAML, block mappings, block sequences,
+// flow collections and scalars. Anchors, tags and multi-line scalars
+// are not supported.
+func ParseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, l := range strings.Split(string(data), "\n") {
+		l = stripComment(strings.TrimRight(l, " \t\r"))
+		if strings.TrimSpace(l) == "" || l == "---" {
+			continue
+		}
+		t := strings.TrimLeft(l, " ")
+		if t[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tab is not allowed in indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{
+			indent: len(l) - len(t),
+			text:   t,
+			no:     i + 1})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, e := p.parseBlock()
+	if e == nil && p.pos < len(p.lines) {
+		e = fmt.Errorf("line %d: invalid indentation", p.lines[p.pos].no)
+	}
+	return v, e
+}
+
+type yamlLine struct {
+	indent int
+	text   string
+	no     int
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) parseBlock() (interface{}, error) {
+	l := p.lines[p.pos]
+	if isSeqItem(l.text) {
+		return p.parseSeq(l.indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.parseMap(l.indent)
+	}
+	p.pos++
+	return parseScalar(l.text)
+}
+
+func (p *yamlParser) parseSeq(indent int) ([]interface{}, error) {
+	s := []interface{}{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isSeqItem(l.text) {
+			break
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, e := p.parseBlock()
+				if e != nil {
+					return nil, e
+				}
+				s = append(s, v)
+			} else {
+				s = append(s, nil)
+			}
+			continue
+		}
+
+		// item is parsed as virtual line with deeper indent
+		p.lines[p.pos] = yamlLine{
+			indent: indent + len(l.text) - len(rest),
+			text:   rest,
+			no:     l.no}
+		v, e := p.parseBlock()
+		if e != nil {
+			return nil, e
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || isSeqItem(l.text) && l.indent == indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: invalid indentation", l.no)
+		}
+		k, v, ok := splitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: mapping key is required", l.no)
+		}
+		p.pos++
+
+		var e error
+		if isPlain(v) && (strings.Contains(v, ": ") || strings.HasSuffix(v, ":")) {
+			return nil, fmt.Errorf("line %d: mapping is not allowed in value", l.no)
+		} else if v != "" {
+			m[k], e = parseScalar(v)
+		} else if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent ||
+			p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text)) {
+			m[k], e = p.parseBlock()
+		} else {
+			m[k] = nil
+		}
+		if e != nil {
+			return nil, e
+		}
+	}
+	return m, nil
+}
+
+// isPlain returns true if t is not empty and not quoted or flow collection
+func isPlain(t string) bool {
+	return len(t) != 0 && !strings.ContainsRune("\"'{[", rune(t[0]))
+}
+
+func isSeqItem(t string) bool {
+	return t == "-" || strings.HasPrefix(t, "- ")
+}
+
+func splitKey(t string) (k, v string, ok bool) {
+	if len(t) == 0 || strings.ContainsRune("{[", rune(t[0])) {
+		return
+	}
+	if t[0] == '"' || t[0] == '\'' {
+		i := strings.IndexByte(t[1:], t[0])
+		if i < 0 {
+			return
+		}
+		k = t[1 : i+1]
+		t = t[i+2:]
+		if !strings.HasPrefix(t, ":") {
+			return
+		}
+		return k, strings.TrimSpace(t[1:]), true
+	}
+	if i := strings.Index(t, ": "); i > 0 {
+		return strings.TrimSpace(t[:i]), strings.TrimSpace(t[i+2:]), true
+	}
+	if strings.HasSuffix(t, ":") {
+		return strings.TrimSpace(t[:len(t)-1]), "", true
+	}
+	return
+}
+
+func stripComment(l string) string {
+	var q byte
+	for i := 0; i < len(l); i++ {
+		switch c := l[i]; {
+		case q != 0:
+			if c == '\\' && q == '"' {
+				i++
+			} else if c == q {
+				q = 0
+			}
+		case c == '"' || c == '\'':
+			q = c
+		case c == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return strings.TrimRight(l[:i], " \t")
+		}
+	}
+	return l
+}
+
+func parseScalar(t string) (interface{}, error) {
+	switch t {
+	case "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	switch t[0] {
+	case '{', '[':
+		f := &flowParser{s: t}
+		v, e := f.parse()
+		if e == nil && f.skip() < len(t) {
+			e = fmt.Errorf("unexpected %q", t[f.i])
+		}
+		if e != nil {
+			return nil, fmt.Errorf("invalid value %s: %s", t, e)
+		}
+		return v, nil
+	case '"':
+		var v string
+		if e := json.Unmarshal([]byte(t), &v); e != nil {
+			return nil, fmt.Errorf("invalid value %s: %s", t, e)
+		}
+		return v, nil
+	case '\'':
+		if len(t) < 2 || t[len(t)-1] != '\'' {
+			return nil, fmt.Errorf("invalid value %s", t)
+		}
+		return strings.Replace(t[1:len(t)-1], "''", "'", -1), nil
+	}
+	// integers are kept exact for 64-bit IDs, non-finite floats are strings
+	if i, e := strconv.ParseInt(t, 10, 64); e == nil {
+		return i, nil
+	}
+	if u, e := strconv.ParseUint(t, 10, 64); e == nil {
+		return u, nil
+	}
+	if f, e := strconv.ParseFloat(t, 64); e == nil &&
+		!math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f, nil
+	}
+	return t, nil
+}
+
+type flowParser struct {
+	s string
+	i int
+}
+
+func (f *flowParser) skip() int {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+	return f.i
+}
+
+func (f *flowParser) parse() (interface{}, error) {
+	if f.skip() == len(f.s) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch f.s[f.i] {
+	case '{':
+		m := map[string]interface{}{}
+		e := f.items('}', func() error {
+			k, e := f.parse()
+			if e != nil {
+				return e
+			}
+			if f.skip() == len(f.s) || f.s[f.i] != ':' {
+				return fmt.Errorf("mapping value is required")
+			}
+			f.i++
+			v, e := f.parse()
+			m[fmt.Sprint(k)] = v
+			return e
+		})
+		return m, e
+	case '[':
+		s := []interface{}{}
+		e := f.items(']', func() error {
+			v, e := f.parse()
+			s = append(s, v)
+			return e
+		})
+		return s, e
+	case '"', '\'':
+		q := f.s[f.i]
+		j := f.i + 1
+		for ; j < len(f.s) && f.s[j] != q; j++ {
+			if q == '"' && f.s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(f.s) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		v, e := parseScalar(f.s[f.i : j+1])
+		f.i = j + 1
+		return v, e
+	}
+	j := f.i
+	for j < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[j])) &&
+		!(f.s[j] == ':' && (j+1 == len(f.s) || f.s[j+1] == ' ')) {
+		j++
+	}
+	t := strings.TrimSpace(f.s[f.i:j])
+	f.i = j
+	if t == "" {
+		return nil, nil
+	}
+	return parseScalar(t)
+}
+
+func (f *flowParser) items(end byte, item func() error) error {
+	f.i++
+	if f.skip() < len(f.s) && f.s[f.i] == end {
+		f.i++
+		return nil
+	}
+	for {
+		if e := item(); e != nil {
+			return e
+		}
+		if f.skip() == len(f.s) {
+			return io.ErrUnexpectedEOF
+		}
+		switch f.s[f.i] {
+		case ',':
+			// trailing comma is allowed
+			if f.i++; f.skip() < len(f.s) && f.s[f.i] == end {
+				f.i++
+				return nil
+			}
+		case end:
+			f.i++
+			return nil
+		default:
+			return fmt.Errorf("unexpected %q", f.s[f.i])
+		}
+	}
+}
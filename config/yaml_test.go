@@ -0,0 +1,128 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type m = map[string]interface{}
+type s = []interface{}
+
+func TestParseYAML(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		exp  interface{}
+	}{
+		{"empty", "\n# comment only\n", nil},
+		{"scalar", "abc", "abc"},
+		{"block mapping", "a: 1\nb: x\nc:\n", m{"a": int64(1), "b": "x", "c": nil}},
+		{"nested mapping", "a:\n  b:\n    c: true\n  d: false\ne: ~",
+			m{"a": m{"b": m{"c": true}, "d": false}, "e": nil}},
+		{"block sequence", "- 1\n- two\n-\n- null", s{int64(1), "two", nil, nil}},
+		{"sequence in mapping", "a:\n- 1\n- 2\nb:\n  - 3",
+			m{"a": s{int64(1), int64(2)}, "b": s{int64(3)}}},
+		{"mapping in sequence", "- a: 1\n  b: 2\n- c: 3",
+			s{m{"a": int64(1), "b": int64(2)}, m{"c": int64(3)}}},
+		{"nested sequence", "-\n  - 1\n  - 2\n- - 3", s{s{int64(1), int64(2)}, s{int64(3)}}},
+		{"flow mapping", "a: {b: 1, 'c': [x, \"y\"], d: {}}",
+			m{"a": m{"b": int64(1), "c": s{"x", "y"}, "d": m{}}}},
+		{"flow sequence", "[1, [2, 3], {a: b, }, ]",
+			s{int64(1), s{int64(2), int64(3)}, m{"a": "b"}}},
+		{"flow null", "{a: , b: [~]}", m{"a": nil, "b": s{nil}}},
+		{"double quoted", `a: "x: y # z\n\"q\""`, m{"a": "x: y # z\n\"q\""}},
+		{"single quoted", `a: 'it''s # not comment'`, m{"a": "it's # not comment"}},
+		{"quoted key", "\"a b\": 1\n'c:d': 2", m{"a b": int64(1), "c:d": int64(2)}},
+		{"quoted number", `a: "123"`, m{"a": "123"}},
+		{"comment", "# head\na: 1 # tail\nb: x#y\n\n---\nc: '#'",
+			m{"a": int64(1), "b": "x#y", "c": "#"}},
+		{"url value", "a: http://example.com:8080/x", m{"a": "http://example.com:8080/x"}},
+		{"64-bit integers", "- 9223372036854775807\n- -9223372036854775808\n- 18446744073709551615",
+			s{int64(9223372036854775807), int64(-9223372036854775808), uint64(18446744073709551615)}},
+		{"float", "- 1.5\n- -2e3", s{1.5, -2e3}},
+		{"non-finite float", "- nan\n- inf\n- -Inf\n- .nan\n- 1e999",
+			s{"nan", "inf", "-Inf", ".nan", "1e999"}},
+		{"CRLF", "a: 1\r\nb: 2\r\n", m{"a": int64(1), "b": int64(2)}},
+	} {
+		v, e := ParseYAML([]byte(c.in))
+		if e != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, e)
+		} else if !reflect.DeepEqual(v, c.exp) {
+			t.Errorf("%s: parsed %#v, expected %#v", c.name, v, c.exp)
+		}
+	}
+}
+
+func TestParseYAMLError(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+	}{
+		{"deeper mapping", "a: 1\n  b: 2"},
+		{"deeper sequence", "- 1\n   - 2"},
+		{"scalar after scalar", "a\nb: 1"},
+		{"key is required", "a:\n  b: 1\n  c"},
+		{"tab indentation", "a:\n\tb: 1"},
+		{"tab after spaces", "a:\n  \tb: 1"},
+		{"nested key value", "a: b: c"},
+		{"nested key", "a: b:"},
+		{"nested key in sequence", "- a: b: c"},
+		{"unclosed flow sequence", "a: [1, 2"},
+		{"unclosed flow mapping", "a: {b: 1"},
+		{"no flow value", "a: {b}"},
+		{"data after flow", "a: [1] x"},
+		{"unclosed quote", `a: "x`},
+		{"unclosed single quote", `a: 'x`},
+	} {
+		if v, e := ParseYAML([]byte(c.in)); e == nil {
+			t.Errorf("%s: no error, parsed %#v", c.name, v)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, e := ioutil.TempDir("", "config")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	type conf struct {
+		ID    uint64      `json:"ID"`
+		Name  string      `json:"name"`
+		Raw   interface{} `json:"raw"`
+		Timer Duration    `json:"timer"`
+	}
+	exp := conf{ID: 18446744073709551615, Name: "nan", Timer: Duration(1500000000)}
+	for n, d := range map[string]string{
+		"c.yaml": "ID: 18446744073709551615\nname: nan\nraw: 12345678901234567890\ntimer: 1.5s",
+		"c.json": `{"ID": 18446744073709551615, "name": "nan", "raw": 12345678901234567890, "timer": "1.5s"}`,
+	} {
+		p := filepath.Join(dir, n)
+		if e = ioutil.WriteFile(p, []byte(d), 0644); e != nil {
+			t.Fatal(e)
+		}
+		var c conf
+		if e = Load(p, &c); e != nil {
+			t.Errorf("%s: load failed: %s", n, e)
+			continue
+		}
+		if r, ok := c.Raw.(interface{ String() string }); !ok ||
+			r.String() != "12345678901234567890" {
+			t.Errorf("%s: raw number is %#v", n, c.Raw)
+		}
+		c.Raw = nil
+		if c != exp {
+			t.Errorf("%s: loaded %+v, expected %+v", n, c, exp)
+		}
+	}
+
+	p := filepath.Join(dir, "trailing.json")
+	ioutil.WriteFile(p, []byte(`{"ID": 1} {}`), 0644)
+	if e = Load(p, &conf{}); e == nil {
+		t.Errorf("no error for trailing data")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fkgi/harico/config"
+	"github.com/fkgi/harico/gtpu"
+)
+
+var (
+	confPath  string
+	confFlags = make(map[string]bool) // flags given in command line
+	tunConf   = Config{Port: 2152}
+	confLock  sync.RWMutex // guards tunConf
+)
+
+// Config of gNB.
+// Local and API are applied only at start up.
+type Config struct {
+	Local  string          `json:"local,omitempty"`
+	API    string          `json:"api,omitempty"`
+	Echo   config.Duration `json:"echo,omitempty"`
+	Device string          `json:"device,omitempty"`
+	FlowID *byte           `json:"flowID,omitempty"`
+	Port   uint16          `json:"port,omitempty"`
+}
+
+func loadConfig() (c Config, e error) {
+	c.Port = 2152
+	if len(confPath) == 0 {
+		return
+	}
+	if e = config.Load(confPath, &c); e != nil {
+		return
+	}
+	if c.Echo < 0 {
+		e = fmt.Errorf("negative timer value")
+	} else if c.FlowID != nil && *c.FlowID > 63 {
+		e = fmt.Errorf("invalid QoS flow ID %d", *c.FlowID)
+	} else if c.Port == 0 {
+		c.Port = 2152
+	}
+	return
+}
+
+// applyConfig updates parameters which can be changed in runtime.
+// Parameters omitted in c are reset to default.
+func applyConfig(c Config) {
+	gtpu.SetTimeEcho(time.Duration(c.Echo))
+	confLock.Lock()
+	tunConf = c
+	confLock.Unlock()
+}
+
+func reloadConfig() {
+	c, e := loadConfig()
+	if e != nil {
+		log.Printf("failed to reload config: %s", e)
+		return
+	}
+	applyConfig(c)
+	log.Printf("config is reloaded from %s", confPath)
+}
@@ -14,10 +14,17 @@ type BindTunnel struct {
 	ID     uint32 `json:"ID"`
 	Device string `json:"device"`
 	IP     net.IP `json:"IP"`
+	// RedundantID and RedundantIP are for redundant transmission
+	RedundantID uint32 `json:"redundantID,omitempty"`
+	RedundantIP net.IP `json:"redundantIP,omitempty"`
 }
 
 func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
-	d := BindTunnel{}
+	confLock.RLock()
+	c := tunConf
+	confLock.RUnlock()
+
+	d := BindTunnel{Device: c.Device}
 	b, e := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -38,7 +45,15 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	d.ID, e = h.Bind(d.ID, d.IP.String()+":2152", d.Device)
+	if d.RedundantID != 0 {
+		d.ID, d.RedundantID, e = h.BindRedundant(d.ID, net.JoinHostPort(
+			d.IP.String(), strconv.Itoa(int(c.Port))), d.RedundantID,
+			net.JoinHostPort(d.RedundantIP.String(), strconv.Itoa(int(c.Port))),
+			d.Device)
+	} else {
+		d.ID, e = h.Bind(d.ID, net.JoinHostPort(
+			d.IP.String(), strconv.Itoa(int(c.Port))), d.Device)
+	}
 	if e != nil {
 		log.Println("GTP-U tunnel binding failed:", e)
 		errorResponse(w, ProblemDetails{
@@ -48,9 +63,15 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 			Instance: r.URL.Path})
 		return
 	}
+	if c.FlowID != nil {
+		h.SetFlowIDto(d.ID, *c.FlowID)
+	}
 
 	ip, _, _ := net.SplitHostPort(l)
 	d.IP = net.ParseIP(ip)
+	if d.RedundantID != 0 {
+		d.RedundantIP = d.IP
+	}
 
 	b, _ = json.Marshal(d)
 	w.Header().Set("Content-Type", "application/json")
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	"github.com/fkgi/harico/gtpu"
+	"github.com/fkgi/harico/pcap"
 )
 
 var (
@@ -30,12 +32,35 @@ func main() {
 
 	la := flag.String("l", "127.0.0.1:2152", "local addr/port")
 	mg := flag.String("m", ":8080", "management API addr/port")
+	pc := flag.String("p", "", "pcap (not pcapng) file of GTP-U packets")
+	flag.StringVar(&confPath, "c", "", "YAML/JSON config file, reloaded on SIGHUP")
 	flag.Parse()
 
+	flag.Visit(func(f *flag.Flag) { confFlags[f.Name] = true })
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatalln("failed to load config:", err)
+	}
+	applyConfig(c)
+	if len(c.Local) != 0 && !confFlags["l"] {
+		*la = c.Local
+	}
+	if len(c.API) != 0 && !confFlags["m"] {
+		*mg = c.API
+	}
+
 	l = *la
 	rand.Seed(time.Now().UnixNano())
 
-	var err error
+	if len(*pc) != 0 {
+		w, err := pcap.Create(*pc)
+		if err != nil {
+			log.Fatalln("failed to create pcap file:", err)
+		}
+		defer w.Close()
+		gtpu.Capture = w
+	}
+
 	h, err = gtpu.StartHandler(*la)
 	if err != nil {
 		log.Fatalln("GTP local binding failed:", err)
@@ -45,9 +70,11 @@ func main() {
 		log.Fatalln(http.ListenAndServe(*mg, http.Handler(apiHandler)))
 	}()
 
-	sigc := make(chan os.Signal)
-	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sigc
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	for s := <-sigc; s == syscall.SIGHUP; s = <-sigc {
+		reloadConfig()
+	}
 	log.Println("shutting down")
 	h.Close()
 
@@ -59,8 +86,17 @@ var apiHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(buf, "Rx API:")
 	fmt.Fprintln(buf, " | method: ", r.Method)
 	fmt.Fprintln(buf, " | authority: ", r.URL.String())
-	fmt.Fprintln(buf, " | body:")
-	fmt.Fprintln(buf, " | |", r.Body)
+	if r.Body != nil {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if len(b) != 0 {
+			fmt.Fprintln(buf, " | body:")
+			for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				fmt.Fprintln(buf, " | |", l)
+			}
+		}
+	}
 	log.Print(buf.String())
 
 	p := r.URL.Path
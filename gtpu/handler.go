@@ -8,14 +8,33 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"sync/atomic"
 	"time"
+
+	"github.com/fkgi/harico/pcap"
 )
 
+const defaultTimeEcho = 60 * time.Second
+
 var (
-	// TimeEcho istime of echo interval
-	TimeEcho time.Duration = 60 * time.Second
+	// timeEcho is time of echo interval, it is accessed atomically
+	timeEcho = int64(defaultTimeEcho)
+	// Capture writes all GTP-U packets if it is not nil
+	Capture *pcap.Writer
+	// Receive handles G-PDU of the TEID which is not bound by Bind.
+	// seq is -1 if the G-PDU has no sequence number.
+	Receive func(teid uint32, peer *net.UDPAddr, qfi byte, seq int, pdu []byte)
 )
 
+// SetTimeEcho changes time of echo interval, default is used if d is 0.
+// It can be called while handlers are running.
+func SetTimeEcho(d time.Duration) {
+	if d == 0 {
+		d = defaultTimeEcho
+	}
+	atomic.StoreInt64(&timeEcho, int64(d))
+}
+
 // Handler handles GTP-U tunnels
 type Handler struct {
 	tun map[uint32]*tunnel // key = local TEID
@@ -27,6 +46,7 @@ type tunnel struct {
 	address   *net.UDPAddr // remote Addr
 	tunDevice *os.File     // unix tun device
 	flowID    byte         // current QoS Flow ID
+	red       *redundancy  // shared with the pair if redundant tunnel
 }
 
 // StartHandler make Handler with local address
@@ -43,10 +63,15 @@ func StartHandler(addr string) (handler Handler, err error) {
 	go func() {
 		b := make([]byte, 1500)
 		for {
-			if n, a, err := handler.con.ReadFromUDP(b); err != nil {
+			n, a, err := handler.con.ReadFromUDP(b)
+			if err != nil {
 				log.Println(err)
 				break
-			} else if err = handler.decapsulate(a, b[:n]); err != nil {
+			}
+			if err = Capture.WriteUDP(a, handler.localAddr(), b[:n]); err != nil {
+				log.Println(err)
+			}
+			if err = handler.decapsulate(a, b[:n]); err != nil {
 				log.Println(err)
 			}
 		}
@@ -55,7 +80,7 @@ func StartHandler(addr string) (handler Handler, err error) {
 
 	go func() {
 		for {
-			time.Sleep(TimeEcho)
+			time.Sleep(time.Duration(atomic.LoadInt64(&timeEcho)))
 
 			ips := make([]net.IP, 0)
 
@@ -73,7 +98,7 @@ func StartHandler(addr string) (handler Handler, err error) {
 				ips = append(ips, t.address.IP)
 
 				handler.seq++
-				_, err = handler.con.WriteToUDP(
+				err = handler.writeTo(
 					[]byte{
 						0x32, 0x01,
 						0x00, 0x04,
@@ -92,6 +117,19 @@ func StartHandler(addr string) (handler Handler, err error) {
 	return
 }
 
+func (h Handler) localAddr() *net.UDPAddr {
+	a, _ := h.con.LocalAddr().(*net.UDPAddr)
+	return a
+}
+
+func (h Handler) writeTo(b []byte, addr *net.UDPAddr) error {
+	if err := Capture.WriteUDP(h.localAddr(), addr, b); err != nil {
+		log.Println(err)
+	}
+	_, err := h.con.WriteToUDP(b, addr)
+	return err
+}
+
 // Close handler
 func (h *Handler) Close() {
 	for id, t := range h.tun {
@@ -164,7 +202,7 @@ func (h Handler) decapsulate(addr *net.UDPAddr, p []byte) error {
 	id = (id << 8) | uint32(q[3])
 
 	var seq uint16
-	// var qfi byte
+	var qfi byte = 255
 	if hdr&0x06 != 0 {
 		n, err = buf.Read(q)
 		if err != nil {
@@ -186,8 +224,9 @@ func (h Handler) decapsulate(addr *net.UDPAddr, p []byte) error {
 				return io.ErrUnexpectedEOF
 			}
 
-			// qfi = q[2] & 0x3f
-			_, err = buf.Seek(int64(q[0])*4, io.SeekCurrent)
+			qfi = q[2] & 0x3f
+			// length is in 4 octets including the 4 octets already read
+			_, err = buf.Seek(int64(q[0])*4-4, io.SeekCurrent)
 			if err != nil {
 				return err
 			}
@@ -196,7 +235,7 @@ func (h Handler) decapsulate(addr *net.UDPAddr, p []byte) error {
 
 	switch mtype {
 	case 0x01:
-		_, err = h.con.WriteToUDP(
+		err = h.writeTo(
 			[]byte{
 				0x32, 0x02,
 				0x00, 0x06,
@@ -206,10 +245,20 @@ func (h Handler) decapsulate(addr *net.UDPAddr, p []byte) error {
 				0x0e, 0x00},
 			addr)
 	case 0xff:
-		if tun, ok := h.tun[id]; !ok {
+		if tun, ok := h.tun[id]; !ok && Receive != nil {
+			pdu := make([]byte, buf.Len())
+			buf.Read(pdu)
+			if hdr&0x02 == 0 {
+				Receive(id, addr, qfi, -1, pdu)
+			} else {
+				Receive(id, addr, qfi, int(seq), pdu)
+			}
+		} else if !ok {
 			err = fmt.Errorf("unknown TEID %d", id)
 		} else if !addr.IP.Equal(tun.address.IP) {
 			err = fmt.Errorf("invalid peer %s for TEID %d", addr, id)
+		} else if tun.red != nil && hdr&0x02 != 0 && tun.red.Duplicated(seq) {
+			// discard duplicated packet of redundant transmission
 		} else {
 			_, err = tun.tunDevice.ReadFrom(buf)
 		}
@@ -261,7 +310,7 @@ func (h *Handler) Bind(id uint32, addr, ifname string) (lid uint32, err error) {
 					0x01, 0x10, t.flowID, 0x00})
 			}
 			buf.Write(b[:n])
-			_, err = h.con.WriteToUDP(buf.Bytes(), t.address)
+			err = h.writeTo(buf.Bytes(), t.address)
 			if err != nil {
 				break
 			}
@@ -270,6 +319,33 @@ func (h *Handler) Bind(id uint32, addr, ifname string) (lid uint32, err error) {
 	return
 }
 
+// Send G-PDU to the TEID of the peer without binding.
+// DL PDU Session Information is added if qfi < 64.
+func (h *Handler) Send(teid uint32, addr *net.UDPAddr, qfi byte, pdu []byte) error {
+	f := byte(0x30)
+	l := len(pdu)
+	if qfi < 64 {
+		f = 0x34
+		l += 8
+	}
+	buf := bytes.NewBuffer([]byte{
+		f, 0xff,
+		byte(l >> 8), byte(l),
+		byte(teid >> 24), byte(teid >> 16), byte(teid >> 8), byte(teid)})
+	if qfi < 64 {
+		buf.Write([]byte{
+			0x00, 0x00, 0x00, 0x85,
+			0x01, 0x00, qfi, 0x00})
+	}
+	buf.Write(pdu)
+	return h.writeTo(buf.Bytes(), addr)
+}
+
+// OpenTun opens the unix tun device
+func OpenTun(ifname string) (*os.File, error) {
+	return getTunFile(ifname)
+}
+
 // Unbind specified GTP-U tunnel on this handler
 func (h *Handler) Unbind(id uint32) error {
 	t, ok := h.tun[id]
@@ -277,6 +353,10 @@ func (h *Handler) Unbind(id uint32) error {
 		return fmt.Errorf("unknown IEID %d", id)
 	}
 	delete(h.tun, id)
+	if t.red != nil {
+		delete(h.tun, t.red.lid[0])
+		delete(h.tun, t.red.lid[1])
+	}
 	t.tunDevice.Close()
 	return nil
 }
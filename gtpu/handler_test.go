@@ -0,0 +1,58 @@
+package gtpu
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDecapsulateSessionContainer(t *testing.T) {
+	type received struct {
+		teid uint32
+		qfi  byte
+		seq  int
+		pdu  string
+	}
+	var r received
+	Receive = func(teid uint32, peer *net.UDPAddr, qfi byte, seq int, pdu []byte) {
+		r = received{teid, qfi, seq, string(pdu)}
+	}
+	defer func() { Receive = nil }()
+
+	h := Handler{tun: make(map[uint32]*tunnel)}
+	peer := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2152}
+	for _, c := range []struct {
+		name string
+		p    []byte
+		exp  received
+	}{
+		{"no extension", []byte{
+			0x30, 0xff, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01,
+			'p', 'd', 'u'}, received{1, 255, -1, "pdu"}},
+		{"container of 4 octets", []byte{
+			0x34, 0xff, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x02,
+			0x00, 0x00, 0x00, 0x85,
+			0x01, 0x10, 0x05, 0x00,
+			'p', 'd', 'u'}, received{2, 5, -1, "pdu"}},
+		{"container of 8 octets with sequence", []byte{
+			0x36, 0xff, 0x00, 0x0f, 0x00, 0x00, 0x00, 0x03,
+			0x00, 0x07, 0x00, 0x85,
+			0x02, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x00,
+			'p', 'd', 'u'}, received{3, 9, 7, "pdu"}},
+	} {
+		r = received{}
+		if e := h.decapsulate(peer, c.p); e != nil {
+			t.Errorf("%s: %s", c.name, e)
+		} else if r != c.exp {
+			t.Errorf("%s: received %+v, expected %+v", c.name, r, c.exp)
+		}
+	}
+
+	// container longer than the packet
+	p := []byte{
+		0x34, 0xff, 0x00, 0x08, 0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x85,
+		0x01, 0x10, 0x05}
+	if e := h.decapsulate(peer, p); e == nil {
+		t.Errorf("no error for truncated container")
+	}
+}
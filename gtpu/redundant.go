@@ -0,0 +1,138 @@
+package gtpu
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+)
+
+// eliminationWindow is number of recent sequence numbers for duplicate detection
+const eliminationWindow = 256
+
+// Eliminator detects duplicated G-PDU of redundant transmission
+// by GTP-U sequence number.
+type Eliminator struct {
+	sync.Mutex
+	seen   map[uint16]bool
+	recent []uint16
+}
+
+// Duplicated returns true if the sequence number is already received recently
+func (e *Eliminator) Duplicated(seq uint16) bool {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.seen == nil {
+		e.seen = make(map[uint16]bool)
+	}
+	if e.seen[seq] {
+		return true
+	}
+	e.seen[seq] = true
+	e.recent = append(e.recent, seq)
+	if len(e.recent) > eliminationWindow {
+		delete(e.seen, e.recent[0])
+		e.recent = e.recent[1:]
+	}
+	return false
+}
+
+// redundancy is shared data of a pair of redundant tunnels
+type redundancy struct {
+	Eliminator
+	lid [2]uint32 // local TEIDs of the pair
+}
+
+// gpdu returns G-PDU with sequence number.
+// PDU Session Container of pduType is added if qfi < 64.
+func gpdu(teid uint32, pduType, qfi byte, seq uint16, pdu []byte) []byte {
+	f := byte(0x32)
+	l := len(pdu) + 4
+	if qfi < 64 {
+		f = 0x36
+		l += 4
+	}
+	buf := bytes.NewBuffer([]byte{
+		f, 0xff,
+		byte(l >> 8), byte(l),
+		byte(teid >> 24), byte(teid >> 16), byte(teid >> 8), byte(teid),
+		byte(seq >> 8), byte(seq), 0x00, 0x00})
+	if qfi < 64 {
+		buf.Bytes()[11] = 0x85
+		buf.Write([]byte{0x01, pduType << 4, qfi, 0x00})
+	}
+	buf.Write(pdu)
+	return buf.Bytes()
+}
+
+// BindRedundant binds a pair of redundant GTP-U tunnels on the tun device.
+// Uplink packets are sent on both tunnels with same sequence number,
+// and duplicated downlink packets are discarded.
+func (h *Handler) BindRedundant(id uint32, addr string, rid uint32, raddr string, ifname string) (lid, rlid uint32, err error) {
+	t := &tunnel{flowID: 255, red: &redundancy{}}
+	if t.address, err = net.ResolveUDPAddr("udp", addr); err != nil {
+		return
+	}
+	rt := &tunnel{flowID: 255, red: t.red}
+	if rt.address, err = net.ResolveUDPAddr("udp", raddr); err != nil {
+		return
+	}
+	if t.tunDevice, err = getTunFile(ifname); err != nil {
+		return
+	}
+	rt.tunDevice = t.tunDevice
+
+	for _, n := range []*tunnel{t, rt} {
+		var l uint32
+		for {
+			l = rand.Uint32()
+			if _, ok := h.tun[l]; !ok && l != 0 {
+				h.tun[l] = n
+				break
+			}
+		}
+		if n == t {
+			lid = l
+		} else {
+			rlid = l
+		}
+	}
+	t.red.lid = [2]uint32{lid, rlid}
+
+	go func() {
+		b := make([]byte, 1500)
+		seq := uint16(rand.Uint32())
+		for {
+			n, err := t.tunDevice.Read(b)
+			if err != nil {
+				break
+			}
+			seq++
+			if err = h.writeTo(gpdu(id, 1, t.flowID, seq, b[:n]), t.address); err != nil {
+				break
+			}
+			if err = h.writeTo(gpdu(rid, 1, t.flowID, seq, b[:n]), rt.address); err != nil {
+				break
+			}
+		}
+	}()
+	return
+}
+
+// SendRedundant sends same G-PDU with same sequence number to
+// the pair of TEIDs of the peer without binding.
+// DL PDU Session Information is added if qfi < 64.
+func (h *Handler) SendRedundant(teid [2]uint32, addr [2]*net.UDPAddr, qfi byte, pdu []byte) error {
+	h.seq++
+	for i := range teid {
+		if addr[i] == nil {
+			return fmt.Errorf("no peer address for TEID %d", teid[i])
+		}
+		if err := h.writeTo(gpdu(teid[i], 0, qfi, h.seq, pdu), addr[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,10 @@ import (
 	"unsafe"
 )
 
+// iffMultiQueue is IFF_MULTI_QUEUE which allows to attach the device
+// from other tunnel while it is attached, e.g. in handover
+const iffMultiQueue = 0x0100
+
 func getTunFile(ifname string) (*os.File, error) {
 	ifreq := struct {
 		name  [syscall.IFNAMSIZ]byte // c string
@@ -13,20 +17,36 @@ func getTunFile(ifname string) (*os.File, error) {
 		_pad  [24 - unsafe.Sizeof(uint16(0))]byte
 	}{}
 	copy(ifreq.name[:], []byte(ifname))
-	ifreq.flags = syscall.IFF_TUN | syscall.IFF_NO_PI
+	ifreq.flags = syscall.IFF_TUN | syscall.IFF_NO_PI | iffMultiQueue
 
-	f, err := os.OpenFile("/dev/net/tun", os.O_RDWR, 0600)
-	if err == nil {
-		_, _, e := syscall.Syscall(
+	fd, err := syscall.Open("/dev/net/tun", syscall.O_RDWR|syscall.O_CLOEXEC, 0600)
+	if err != nil {
+		return nil, os.NewSyscallError("open", err)
+	}
+	_, _, e := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		uintptr(fd),
+		syscall.TUNSETIFF,
+		uintptr(unsafe.Pointer(&ifreq)))
+	if e == syscall.EINVAL {
+		// existing single queue device
+		ifreq.flags = syscall.IFF_TUN | syscall.IFF_NO_PI
+		_, _, e = syscall.Syscall(
 			syscall.SYS_IOCTL,
-			f.Fd(),
+			uintptr(fd),
 			syscall.TUNSETIFF,
 			uintptr(unsafe.Pointer(&ifreq)))
-		if e != 0 {
-			f.Close()
-			f = nil
-			err = os.NewSyscallError("ioctl", e)
-		}
 	}
-	return f, err
+	if e != 0 {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("ioctl", e)
+	}
+
+	// non-blocking file is used with poller,
+	// Close must interrupt the Read of the device for re-binding
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	return os.NewFile(uintptr(fd), "/dev/net/tun"), nil
 }
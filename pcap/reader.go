@@ -0,0 +1,234 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// Packet is UDP datagram in pcap file
+type Packet struct {
+	Time    time.Time
+	Src     *net.UDPAddr
+	Dst     *net.UDPAddr
+	Payload []byte
+}
+
+// ReadUDP reads all UDP datagrams in pcap or pcapng file.
+// Fragmented IP packets are ignored.
+func ReadUDP(path string) ([]Packet, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 24 {
+		return nil, fmt.Errorf("too short file")
+	}
+
+	switch binary.LittleEndian.Uint32(b) {
+	case 0xa1b2c3d4:
+		return readPcap(b, binary.LittleEndian, time.Microsecond)
+	case 0xa1b23c4d:
+		return readPcap(b, binary.LittleEndian, time.Nanosecond)
+	case 0xd4c3b2a1:
+		return readPcap(b, binary.BigEndian, time.Microsecond)
+	case 0x4d3cb2a1:
+		return readPcap(b, binary.BigEndian, time.Nanosecond)
+	case 0x0a0d0d0a:
+		return readPcapng(b)
+	}
+	return nil, fmt.Errorf("unknown file format")
+}
+
+func readPcap(b []byte, o binary.ByteOrder, res time.Duration) ([]Packet, error) {
+	lt := o.Uint32(b[20:]) & 0x0fffffff
+	b = b[24:]
+
+	var pkts []Packet
+	for len(b) >= 16 {
+		l := int(o.Uint32(b[8:]))
+		if len(b) < 16+l {
+			return pkts, fmt.Errorf("truncated record")
+		}
+		t := time.Unix(int64(o.Uint32(b)), int64(o.Uint32(b[4:]))*int64(res))
+		if p, ok := decodeLink(lt, b[16:16+l]); ok {
+			p.Time = t
+			pkts = append(pkts, p)
+		}
+		b = b[16+l:]
+	}
+	return pkts, nil
+}
+
+func readPcapng(b []byte) ([]Packet, error) {
+	var o binary.ByteOrder = binary.LittleEndian
+	type iface struct {
+		linkType uint32
+		res      time.Duration
+	}
+	var ifs []iface
+
+	var pkts []Packet
+	for len(b) >= 12 {
+		bt := o.Uint32(b)
+		if bt == 0x0a0d0d0a {
+			if binary.LittleEndian.Uint32(b[8:]) == 0x1a2b3c4d {
+				o = binary.LittleEndian
+			} else {
+				o = binary.BigEndian
+			}
+			ifs = nil
+		}
+		l := int(o.Uint32(b[4:]))
+		if l < 12 || len(b) < l {
+			return pkts, fmt.Errorf("truncated block")
+		}
+		body := b[8 : l-4]
+		b = b[l:]
+
+		switch bt {
+		case 0x00000001:
+			if len(body) < 8 {
+				continue
+			}
+			f := iface{
+				linkType: uint32(o.Uint16(body)),
+				res:      time.Microsecond}
+			for opt := body[8:]; len(opt) >= 4; {
+				c, ol := o.Uint16(opt), int(o.Uint16(opt[2:]))
+				if c == 0 || len(opt) < 4+ol {
+					break
+				}
+				if c == 9 && ol >= 1 {
+					v := opt[4]
+					f.res = time.Second
+					for i := 0; i < int(v&0x7f); i++ {
+						if v&0x80 == 0 {
+							f.res /= 10
+						} else {
+							f.res /= 2
+						}
+					}
+				}
+				opt = opt[4+(ol+3)/4*4:]
+			}
+			ifs = append(ifs, f)
+		case 0x00000006:
+			if len(body) < 20 {
+				continue
+			}
+			id := int(o.Uint32(body))
+			if id >= len(ifs) {
+				continue
+			}
+			cl := int(o.Uint32(body[12:]))
+			if len(body) < 20+cl {
+				continue
+			}
+			ts := uint64(o.Uint32(body[4:]))<<32 | uint64(o.Uint32(body[8:]))
+			if p, ok := decodeLink(ifs[id].linkType, body[20:20+cl]); ok {
+				p.Time = time.Unix(0, 0).Add(time.Duration(ts) * ifs[id].res)
+				pkts = append(pkts, p)
+			}
+		}
+	}
+	return pkts, nil
+}
+
+func decodeLink(lt uint32, b []byte) (Packet, bool) {
+	var et uint16
+	switch lt {
+	case 0: // BSD loopback
+		if len(b) < 4 {
+			return Packet{}, false
+		}
+		switch b[0] | b[3] {
+		case 2:
+			et = 0x0800
+		case 10, 24, 28, 30:
+			et = 0x86dd
+		}
+		b = b[4:]
+	case 1: // Ethernet
+		if len(b) < 14 {
+			return Packet{}, false
+		}
+		et = binary.BigEndian.Uint16(b[12:])
+		b = b[14:]
+		for (et == 0x8100 || et == 0x88a8) && len(b) >= 4 {
+			et = binary.BigEndian.Uint16(b[2:])
+			b = b[4:]
+		}
+	case 113: // Linux cooked capture
+		if len(b) < 16 {
+			return Packet{}, false
+		}
+		et = binary.BigEndian.Uint16(b[14:])
+		b = b[16:]
+	case 276: // Linux cooked capture v2
+		if len(b) < 20 {
+			return Packet{}, false
+		}
+		et = binary.BigEndian.Uint16(b)
+		b = b[20:]
+	case 101, 228, 229: // Raw IP
+		if len(b) == 0 {
+			return Packet{}, false
+		}
+		if b[0]>>4 == 4 {
+			et = 0x0800
+		} else {
+			et = 0x86dd
+		}
+	default:
+		return Packet{}, false
+	}
+
+	var src, dst net.IP
+	switch et {
+	case 0x0800:
+		if len(b) < 20 || b[9] != 17 {
+			return Packet{}, false
+		}
+		if binary.BigEndian.Uint16(b[6:])&0x3fff != 0 {
+			return Packet{}, false
+		}
+		hl := int(b[0]&0x0f) * 4
+		tl := int(binary.BigEndian.Uint16(b[2:]))
+		if hl < 20 || tl < hl || len(b) < tl {
+			return Packet{}, false
+		}
+		src, dst = net.IP(b[12:16]), net.IP(b[16:20])
+		b = b[hl:tl]
+	case 0x86dd:
+		if len(b) < 40 || b[6] != 17 {
+			return Packet{}, false
+		}
+		pl := int(binary.BigEndian.Uint16(b[4:]))
+		if len(b) < 40+pl {
+			return Packet{}, false
+		}
+		src, dst = net.IP(b[8:24]), net.IP(b[24:40])
+		b = b[40 : 40+pl]
+	default:
+		return Packet{}, false
+	}
+
+	if len(b) < 8 {
+		return Packet{}, false
+	}
+	ul := int(binary.BigEndian.Uint16(b[4:]))
+	if ul < 8 || len(b) < ul {
+		return Packet{}, false
+	}
+	return Packet{
+		Src: &net.UDPAddr{
+			IP:   append(net.IP{}, src...),
+			Port: int(binary.BigEndian.Uint16(b))},
+		Dst: &net.UDPAddr{
+			IP:   append(net.IP{}, dst...),
+			Port: int(binary.BigEndian.Uint16(b[2:]))},
+		Payload: append([]byte{}, b[8:ul]...)}, true
+}
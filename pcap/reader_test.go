@@ -0,0 +1,148 @@
+package pcap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func checkPacket(t *testing.T, name string, p Packet, tm time.Time, src, dst string, payload string) {
+	if !p.Time.Equal(tm) {
+		t.Errorf("%s: time is %s, expected %s", name, p.Time.UTC(), tm.UTC())
+	}
+	if p.Src.String() != src || p.Dst.String() != dst {
+		t.Errorf("%s: %s -> %s, expected %s -> %s", name, p.Src, p.Dst, src, dst)
+	}
+	if string(p.Payload) != payload {
+		t.Errorf("%s: payload is % x, expected % x", name, p.Payload, payload)
+	}
+}
+
+func TestReadPcap(t *testing.T) {
+	pkts, e := ReadUDP("testdata/le_usec.pcap")
+	if e != nil {
+		t.Fatal(e)
+	}
+	// fragment, TCP and ARP are ignored
+	if len(pkts) != 2 {
+		t.Fatalf("%d packets, expected 2", len(pkts))
+	}
+	checkPacket(t, "LE/us", pkts[0], time.Unix(1700000000, 123456000),
+		"10.0.0.1:8805", "10.0.0.2:8806", "abc")
+	checkPacket(t, "LE/us VLAN", pkts[1], time.Unix(1700000001, 123456000),
+		"10.0.0.2:2152", "10.0.0.1:2152", "\x01\x02")
+
+	if pkts, e = ReadUDP("testdata/be_nsec.pcap"); e != nil {
+		t.Fatal(e)
+	} else if len(pkts) != 1 {
+		t.Fatalf("%d packets, expected 1", len(pkts))
+	}
+	checkPacket(t, "BE/ns SLL", pkts[0], time.Unix(1700000000, 123456789),
+		"[2001:db8::1]:8805", "[2001:db8::2]:8805", "ipv6")
+
+	if _, e = ReadUDP("testdata/truncated.pcap"); e == nil {
+		t.Errorf("no error for truncated record")
+	}
+}
+
+func TestReadPcapng(t *testing.T) {
+	pkts, e := ReadUDP("testdata/test.pcapng")
+	if e != nil {
+		t.Fatal(e)
+	}
+	// packet of undefined interface is ignored
+	if len(pkts) != 2 {
+		t.Fatalf("%d packets, expected 2", len(pkts))
+	}
+	checkPacket(t, "LE/ns Ethernet", pkts[0], time.Unix(1700000000, 123456789),
+		"10.0.0.1:8805", "10.0.0.2:8805", "ng1")
+	checkPacket(t, "BE/us raw", pkts[1], time.Unix(1700000000, 1000),
+		"10.0.0.2:8805", "10.0.0.1:8805", "ng2")
+
+	b, _ := ioutil.ReadFile("testdata/test.pcapng")
+	p := filepath.Join(t.TempDir(), "truncated.pcapng")
+	ioutil.WriteFile(p, b[:len(b)-2], 0644)
+	if _, e = ReadUDP(p); e == nil {
+		t.Errorf("no error for truncated block")
+	}
+}
+
+func TestReadUnknown(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "x.pcap")
+	ioutil.WriteFile(p, bytes.Repeat([]byte{0xff}, 24), 0644)
+	if _, e := ReadUDP(p); e == nil {
+		t.Errorf("no error for unknown format")
+	}
+	ioutil.WriteFile(p, []byte{0xd4, 0xc3, 0xb2, 0xa1}, 0644)
+	if _, e := ReadUDP(p); e == nil {
+		t.Errorf("no error for too short file")
+	}
+}
+
+func TestDecodeLink(t *testing.T) {
+	ip := []byte{
+		0x45, 0, 0, 31, 0, 1, 0x40, 0, 64, 17, 0, 0,
+		192, 0, 2, 1, 192, 0, 2, 2,
+		0x08, 0x68, 0x08, 0x68, 0, 11, 0, 0, 'a', 'b', 'c'}
+	for _, c := range []struct {
+		name string
+		lt   uint32
+		hdr  []byte
+		ok   bool
+	}{
+		{"BSD loopback", 0, []byte{2, 0, 0, 0}, true},
+		{"BSD loopback BE", 0, []byte{0, 0, 0, 2}, true},
+		{"raw", 101, nil, true},
+		{"raw IPv4", 228, nil, true},
+		{"SLL2", 276, append([]byte{0x08, 0x00}, make([]byte, 18)...), true},
+		{"unknown link", 105, nil, false},
+	} {
+		p, ok := decodeLink(c.lt, append(append([]byte{}, c.hdr...), ip...))
+		if ok != c.ok {
+			t.Errorf("%s: decoded is %t", c.name, ok)
+		} else if ok && (string(p.Payload) != "abc" ||
+			p.Src.String() != "192.0.2.1:2152" || p.Dst.String() != "192.0.2.2:2152") {
+			t.Errorf("%s: decoded %s -> %s % x", c.name, p.Src, p.Dst, p.Payload)
+		}
+	}
+
+	// length in UDP header exceeds the packet
+	bad := append([]byte{}, ip...)
+	bad[25] = 20
+	if _, ok := decodeLink(101, bad); ok {
+		t.Errorf("invalid UDP length is decoded")
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "w.pcap")
+	w, e := Create(p)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a4 := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8805}
+	b4 := &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: 8805}
+	a6 := &net.UDPAddr{IP: net.ParseIP("::1"), Port: 2152}
+	w.WriteUDP(a4, b4, []byte("v4"))
+	w.WriteUDP(a6, a6, []byte("v6"))
+	w.Close()
+
+	pkts, e := ReadUDP(p)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(pkts) != 2 {
+		t.Fatalf("%d packets, expected 2", len(pkts))
+	}
+	for i, x := range [][3]string{
+		{"127.0.0.1:8805", "127.0.0.2:8805", "v4"},
+		{"[::1]:2152", "[::1]:2152", "v6"}} {
+		if pkts[i].Src.String() != x[0] || pkts[i].Dst.String() != x[1] ||
+			string(pkts[i].Payload) != x[2] {
+			t.Errorf("packet #%d is %s -> %s %q", i, pkts[i].Src, pkts[i].Dst, pkts[i].Payload)
+		}
+	}
+}
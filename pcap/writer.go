@@ -0,0 +1,131 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Writer writes UDP datagrams to classic pcap file
+// with synthetic IP/UDP header, pcapng is not written
+type Writer struct {
+	file *os.File
+	lock sync.Mutex
+	id   uint16 // IPv4 identification
+}
+
+// Create pcap file and write file header
+func Create(path string) (w *Writer, err error) {
+	w = &Writer{}
+	if w.file, err = os.Create(path); err != nil {
+		return
+	}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4) // magic (micro second)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)          // major version
+	binary.LittleEndian.PutUint16(hdr[6:], 4)          // minor version
+	binary.LittleEndian.PutUint32(hdr[16:], 65535)     // snap length
+	binary.LittleEndian.PutUint32(hdr[20:], 101)       // LINKTYPE_RAW
+	if _, err = w.file.Write(hdr); err != nil {
+		w.file.Close()
+	}
+	return
+}
+
+// Close pcap file
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.file.Close()
+}
+
+// WriteUDP writes a record of UDP datagram from src to dst
+func (w *Writer) WriteUDP(src, dst *net.UDPAddr, payload []byte) error {
+	if w == nil || src == nil || dst == nil {
+		return nil
+	}
+
+	udp := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	copy(udp[8:], payload)
+
+	var pkt []byte
+	if s, d := src.IP.To4(), dst.IP.To4(); s != nil && d != nil {
+		pkt = make([]byte, 20, 20+len(udp))
+		pkt[0] = 0x45
+		binary.BigEndian.PutUint16(pkt[2:], uint16(20+len(udp)))
+		w.lock.Lock()
+		w.id++
+		binary.BigEndian.PutUint16(pkt[4:], w.id)
+		w.lock.Unlock()
+		pkt[6] = 0x40 // DF
+		pkt[8] = 64
+		pkt[9] = 17
+		copy(pkt[12:], s)
+		copy(pkt[16:], d)
+		binary.BigEndian.PutUint16(pkt[10:], checksum(0, pkt))
+	} else {
+		s, d = src.IP.To16(), dst.IP.To16()
+		if s == nil {
+			s = net.IPv6unspecified
+		}
+		if d == nil {
+			d = net.IPv6unspecified
+		}
+		pkt = make([]byte, 40, 40+len(udp))
+		pkt[0] = 0x60
+		binary.BigEndian.PutUint16(pkt[4:], uint16(len(udp)))
+		pkt[6] = 17
+		pkt[7] = 64
+		copy(pkt[8:], s)
+		copy(pkt[24:], d)
+
+		// pseudo header checksum is mandatory for IPv6
+		var sum uint32
+		sum = sumWords(sum, pkt[8:40])
+		sum += uint32(len(udp)) + 17
+		c := checksum(sum, udp)
+		if c == 0 {
+			c = 0xffff
+		}
+		binary.BigEndian.PutUint16(udp[6:], c)
+	}
+	pkt = append(pkt, udp...)
+
+	now := time.Now()
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(pkt)))
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, err := w.file.Write(rec); err != nil {
+		return err
+	}
+	_, err := w.file.Write(pkt)
+	return err
+}
+
+func sumWords(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func checksum(sum uint32, b []byte) uint16 {
+	sum = sumWords(sum, b)
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,140 @@
+// Package pfcp decodes PFCP message, IE and Node ID
+// which are shared by SMF and UPF.
+package pfcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// Message of PFCP
+type Message struct {
+	MessageType byte
+	SessionID   uint64
+	Sequence    uint32
+	Priority    byte
+	IEs         []IE
+}
+
+// IE of PFCP
+type IE struct {
+	IEType uint16
+	Data   []byte
+}
+
+// Parse decodes PFCP message header and IEs in data
+func Parse(data []byte) (m Message, e error) {
+	buf := bytes.NewReader(data)
+	var flg byte
+	var n uint16
+
+	if flg, e = buf.ReadByte(); e != nil {
+		e = fmt.Errorf("failed to read header option: %s", e)
+		return
+	}
+	if flg != 0x20 && flg != 0x21 {
+		e = fmt.Errorf("invalid header options %d", flg)
+		return
+	}
+
+	if m.MessageType, e = buf.ReadByte(); e != nil {
+		e = fmt.Errorf("failed to read message type: %s", e)
+		return
+	}
+
+	if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+		e = fmt.Errorf("failed to read message length: %s", e)
+		return
+	}
+	if int(n) != buf.Len() {
+		e = fmt.Errorf("invalid message length value: %d", n)
+		return
+	}
+
+	if flg&0x01 == 0x01 {
+		if e = binary.Read(buf, binary.BigEndian, &m.SessionID); e != nil {
+			e = fmt.Errorf("failed to read session ID: %s", e)
+			return
+		}
+	}
+	if e = binary.Read(buf, binary.BigEndian, &m.Sequence); e != nil {
+		e = fmt.Errorf("failed to read message sequence: %s", e)
+		return
+	}
+	m.Priority = byte(m.Sequence>>4) & 0x0f
+	m.Sequence = m.Sequence >> 8
+
+	b := make([]byte, buf.Len())
+	buf.Read(b)
+	if m.IEs, e = DecodeIEs(b); e != nil {
+		e = fmt.Errorf("failed to read IEs: %s", e)
+	}
+	return
+}
+
+// DecodeIEs decodes list of IEs in b, IE with no data is allowed
+func DecodeIEs(b []byte) (ies []IE, e error) {
+	buf := bytes.NewReader(b)
+	var n uint16
+	var l int
+
+	ies = []IE{}
+	for buf.Len() > 0 {
+		ie := IE{}
+		if e = binary.Read(buf, binary.BigEndian, &ie.IEType); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		ie.Data = make([]byte, int(n))
+		if n == 0 {
+			ies = append(ies, ie)
+			continue
+		}
+		if l, e = buf.Read(ie.Data); e != nil {
+			break
+		}
+		if l != len(ie.Data) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+		ies = append(ies, ie)
+	}
+	return
+}
+
+// DecodeNodeID returns IP address or FQDN in data of Node ID IE
+func DecodeNodeID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", fmt.Errorf("invalid data")
+	}
+	switch b[0] & 0x0f {
+	case 0:
+		if len(b) < 5 {
+			return "", fmt.Errorf("invalid data")
+		}
+		return net.IP(b[1:5]).String(), nil
+	case 1:
+		if len(b) < 17 {
+			return "", fmt.Errorf("invalid data")
+		}
+		return net.IP(b[1:17]).String(), nil
+	case 2:
+		var ls []string
+		for d := b[1:]; len(d) != 0; {
+			l := int(d[0])
+			if l > 63 || len(d) < l+1 {
+				return "", fmt.Errorf("invalid data")
+			}
+			ls = append(ls, string(d[1:l+1]))
+			d = d[l+1:]
+		}
+		return strings.Join(ls, "."), nil
+	}
+	return "", fmt.Errorf("invalid Node ID type %d", b[0]&0x0f)
+}
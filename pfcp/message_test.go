@@ -0,0 +1,93 @@
+package pfcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	// session related message with SEID and IE of no data at the end
+	b := []byte{0x21, 52, 0, 21,
+		1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 9, 0x30,
+		0, 19, 0, 1, 1, 0, 40, 0, 0}
+	m, e := Parse(b)
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := Message{MessageType: 52, SessionID: 0x0102030405060708, Sequence: 9, Priority: 3,
+		IEs: []IE{{IEType: 19, Data: []byte{1}}, {IEType: 40, Data: []byte{}}}}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("parsed %+v, expected %+v", m, exp)
+	}
+
+	// node related message without SEID
+	if m, e = Parse([]byte{0x20, 1, 0, 4, 0, 0, 1, 0}); e != nil {
+		t.Fatal(e)
+	} else if m.MessageType != 1 || m.Sequence != 1 || len(m.IEs) != 0 {
+		t.Errorf("parsed %+v", m)
+	}
+
+	for n, b := range map[string][]byte{
+		"version":     {0x40, 1, 0, 4, 0, 0, 1, 0},
+		"length":      {0x20, 1, 0, 5, 0, 0, 1, 0},
+		"no sequence": {0x20, 1, 0, 2, 0, 0},
+		"truncated IE": {0x20, 1, 0, 9, 0, 0, 1, 0,
+			0, 19, 0, 2, 1},
+	} {
+		if _, e = Parse(b); e == nil {
+			t.Errorf("%s: no error", n)
+		}
+	}
+}
+
+func TestDecodeIEs(t *testing.T) {
+	ies, e := DecodeIEs([]byte{0, 40, 0, 0, 0, 19, 0, 1, 1, 0, 40, 0, 0})
+	if e != nil {
+		t.Fatal(e)
+	}
+	exp := []IE{{IEType: 40, Data: []byte{}},
+		{IEType: 19, Data: []byte{1}}, {IEType: 40, Data: []byte{}}}
+	if !reflect.DeepEqual(ies, exp) {
+		t.Errorf("decoded %+v, expected %+v", ies, exp)
+	}
+
+	for n, b := range map[string][]byte{
+		"no length":  {0, 19, 0},
+		"short data": {0, 19, 0, 2, 1},
+	} {
+		if _, e = DecodeIEs(b); e == nil {
+			t.Errorf("%s: no error", n)
+		}
+	}
+}
+
+func TestDecodeNodeID(t *testing.T) {
+	label := make([]byte, 63)
+	for i := range label {
+		label[i] = 'a'
+	}
+	for _, c := range []struct {
+		name string
+		b    []byte
+		exp  string
+		ok   bool
+	}{
+		{"IPv4", []byte{0x00, 192, 0, 2, 1}, "192.0.2.1", true},
+		{"IPv6", append([]byte{0x01, 0x20, 0x01, 0x0d, 0xb8}, make([]byte, 12)...),
+			"2001:db8::", true},
+		{"FQDN", []byte{0x02, 3, 's', 'm', 'f', 4, 't', 'e', 's', 't'}, "smf.test", true},
+		{"63 octets label", append([]byte{0x02, 63}, label...), string(label), true},
+		{"64 octets label", append(append([]byte{0x02, 64}, label...), 'a'), "", false},
+		{"255 octets label", append([]byte{0x02, 0xff}, make([]byte, 300)...), "", false},
+		{"truncated FQDN", []byte{0x02, 4, 't', 'e'}, "", false},
+		{"short IPv4", []byte{0x00, 192, 0, 2}, "", false},
+		{"short IPv6", []byte{0x01, 0x20, 0x01}, "", false},
+		{"unknown type", []byte{0x03, 0}, "", false},
+		{"empty", nil, "", false},
+	} {
+		n, e := DecodeNodeID(c.b)
+		if (e == nil) != c.ok || n != c.exp {
+			t.Errorf("%s: decoded %q, %v", c.name, n, e)
+		}
+	}
+}
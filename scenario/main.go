@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.Println("starting HARICO scenario runner")
+
+	smf := flag.String("smf", "http://localhost:8080", "SMF management API URL")
+	gnb := flag.String("gnb", "http://localhost:8081", "gNB management API URL")
+	ju := flag.String("junit", "", "JUnit XML report file")
+	v := flag.Bool("v", false, "verbose log with step results")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatalln("no scenario file")
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	report := junitSuites{}
+	start := time.Now()
+	ng := 0
+	for _, p := range flag.Args() {
+		s, e := loadScenario(p)
+		if e != nil {
+			log.Fatalf("failed to load scenario %s: %s", p, e)
+		}
+
+		r := &runner{
+			targets: map[string]string{"smf": *smf, "gnb": *gnb},
+			vars:    map[string]interface{}{},
+			verbose: *v}
+		for k, t := range s.Targets {
+			if !set[k] {
+				r.targets[k] = t
+			}
+		}
+		for k, a := range s.Vars {
+			r.vars[k] = a
+		}
+
+		log.Printf("scenario %s", s.Name)
+		suite := junitSuite{Name: s.Name}
+		st := time.Now()
+		failed := false
+		for _, step := range s.Steps {
+			c := junitCase{Name: step.Name, Classname: s.Name}
+			if failed {
+				log.Printf(" | SKIP %s", step.Name)
+				c.Time = seconds(0)
+				c.Skipped = &junitSkipped{Message: "previous step failed"}
+				suite.add(c)
+				continue
+			}
+
+			t := time.Now()
+			e := r.run(step)
+			c.Time = seconds(time.Since(t))
+			if e != nil {
+				log.Printf(" | FAIL %s: %s", step.Name, e)
+				c.Failure = &junitFailure{Message: e.Error(), Text: e.Error()}
+				failed = true
+			} else {
+				log.Printf(" | PASS %s", step.Name)
+			}
+			suite.add(c)
+		}
+		suite.Time = seconds(time.Since(st))
+		report.Suites = append(report.Suites, suite)
+		if failed {
+			ng++
+		}
+	}
+	report.Time = seconds(time.Since(start))
+
+	if len(*ju) != 0 {
+		if e := writeJUnit(*ju, report); e != nil {
+			log.Fatalf("failed to write JUnit report: %s", e)
+		}
+	}
+
+	log.Printf("%d of %d scenarios failed", ng, len(report.Suites))
+	if ng != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fkgi/harico/config"
+)
+
+// Scenario is a sequence of steps against the SMF and gNB API
+type Scenario struct {
+	Name    string                 `json:"name"`
+	Targets map[string]string      `json:"targets,omitempty"`
+	Vars    map[string]interface{} `json:"vars,omitempty"`
+	Steps   []Step                 `json:"steps"`
+}
+
+// Step of scenario
+type Step struct {
+	Name    string                 `json:"name"`
+	Request *Request               `json:"request,omitempty"`
+	Exec    []string               `json:"exec,omitempty"`
+	Sleep   string                 `json:"sleep,omitempty"`
+	Timeout string                 `json:"timeout,omitempty"`
+	Expect  map[string]interface{} `json:"expect,omitempty"`
+	Capture map[string]string      `json:"capture,omitempty"`
+}
+
+// Request of HTTP API
+type Request struct {
+	Target string      `json:"target"`
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+func loadScenario(p string) (s Scenario, e error) {
+	if e = config.Load(p, &s); e != nil {
+		return
+	}
+
+	if len(s.Name) == 0 {
+		s.Name = strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	}
+	for i, st := range s.Steps {
+		n := 0
+		if st.Request != nil {
+			n++
+		}
+		if len(st.Exec) != 0 {
+			n++
+		}
+		if len(st.Sleep) != 0 {
+			n++
+		}
+		if n != 1 {
+			e = fmt.Errorf("step %d: one of request, exec or sleep is required", i)
+			return
+		}
+		if len(st.Name) == 0 {
+			s.Steps[i].Name = fmt.Sprintf("step%d", i)
+		}
+	}
+	return
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	varRef     = regexp.MustCompile(`\$\{([^}:]+)(:x)?\}`)
+	defTimeout = time.Second * 10
+)
+
+type runner struct {
+	targets map[string]string
+	vars    map[string]interface{}
+	verbose bool
+}
+
+func (r *runner) run(st Step) error {
+	if len(st.Sleep) != 0 {
+		d, e := time.ParseDuration(st.Sleep)
+		if e != nil {
+			return fmt.Errorf("invalid sleep: %s", e)
+		}
+		time.Sleep(d)
+		return nil
+	}
+
+	t := defTimeout
+	if len(st.Timeout) != 0 {
+		var e error
+		if t, e = time.ParseDuration(st.Timeout); e != nil {
+			return fmt.Errorf("invalid timeout: %s", e)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t)
+	defer cancel()
+
+	var res map[string]interface{}
+	var e error
+	expect := map[string]interface{}{}
+	if st.Request != nil {
+		expect["status"] = map[string]interface{}{"lt": 400}
+		res, e = r.request(ctx, st.Request)
+	} else {
+		expect["exit"] = 0
+		res, e = r.exec(ctx, st.Exec)
+	}
+	if e != nil {
+		return e
+	}
+	if r.verbose {
+		b, _ := json.MarshalIndent(res, "", "  ")
+		log.Printf("result of %s:\n%s", st.Name, b)
+	}
+
+	for k, v := range st.Expect {
+		expect[k] = r.expand(v)
+	}
+	for k, v := range expect {
+		a, ok := lookup(res, k)
+		if e = assert(a, ok, v); e != nil {
+			return fmt.Errorf("%s: %s", k, e)
+		}
+	}
+
+	for k, p := range st.Capture {
+		a, ok := lookup(res, p)
+		if !ok {
+			return fmt.Errorf("capture %s: %s not found", k, p)
+		}
+		r.vars[k] = a
+	}
+	return nil
+}
+
+func (r *runner) request(ctx context.Context, q *Request) (map[string]interface{}, error) {
+	base, ok := r.targets[q.Target]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %s", q.Target)
+	}
+	var body *bytes.Reader
+	if q.Body != nil {
+		b, e := json.Marshal(r.expand(q.Body))
+		if e != nil {
+			return nil, e
+		}
+		body = bytes.NewReader(b)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	hr, e := http.NewRequest(
+		strings.ToUpper(q.Method), base+r.expand(q.Path).(string), body)
+	if e != nil {
+		return nil, e
+	}
+	hr = hr.WithContext(ctx)
+	if q.Body != nil {
+		hr.Header.Set("Content-Type", "application/json")
+	}
+	hs, e := http.DefaultClient.Do(hr)
+	if e != nil {
+		return nil, e
+	}
+	defer hs.Body.Close()
+	b, e := ioutil.ReadAll(hs.Body)
+	if e != nil {
+		return nil, e
+	}
+
+	h := map[string]interface{}{}
+	for k := range hs.Header {
+		h[strings.ToLower(k)] = hs.Header.Get(k)
+	}
+	res := map[string]interface{}{
+		"status": hs.StatusCode,
+		"header": h}
+	if len(b) != 0 {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		var v interface{}
+		if d.Decode(&v) == nil {
+			res["body"] = v
+		} else {
+			res["body"] = string(b)
+		}
+	}
+	return res, nil
+}
+
+func (r *runner) exec(ctx context.Context, args []string) (map[string]interface{}, error) {
+	for i := range args {
+		args[i] = fmt.Sprint(r.expand(args[i]))
+	}
+	b, e := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	c := 0
+	if ee, ok := e.(*exec.ExitError); ok {
+		c = ee.ExitCode()
+	} else if e != nil {
+		return nil, e
+	}
+	return map[string]interface{}{
+		"exit":   c,
+		"output": string(b)}, nil
+}
+
+// expand replaces ${name} with value of the variable.
+// ${name:x} is replaced with hex string of non-negative integer value.
+func (r *runner) expand(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if m := varRef.FindStringSubmatch(v); m != nil && m[0] == v && m[2] == "" {
+			if a, ok := r.vars[m[1]]; ok {
+				return a
+			}
+			return v
+		}
+		return varRef.ReplaceAllStringFunc(v, func(s string) string {
+			m := varRef.FindStringSubmatch(s)
+			a, ok := r.vars[m[1]]
+			if !ok {
+				return s
+			}
+			// value which is not non-negative integer is written as is
+			if n, ok := toInteger(a); ok && m[2] != "" {
+				return strconv.FormatUint(n, 16)
+			}
+			if b, ok := a.(string); ok {
+				return b
+			}
+			b, _ := json.Marshal(a)
+			return string(b)
+		})
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, a := range v {
+			m[k] = r.expand(a)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, a := range v {
+			s[i] = r.expand(a)
+		}
+		return s
+	}
+	return v
+}
+
+// lookup returns value of dotted path such as body.PDR.0.FTEID.ID
+func lookup(v interface{}, p string) (interface{}, bool) {
+	for _, k := range strings.Split(p, ".") {
+		switch a := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = a[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, e := strconv.Atoi(k)
+			if e != nil || i < 0 || i >= len(a) {
+				return nil, false
+			}
+			v = a[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "ge": true, "lt": true, "le": true,
+	"exists": true, "contains": true, "match": true}
+
+func assert(a interface{}, found bool, x interface{}) error {
+	ops, ok := x.(map[string]interface{})
+	if ok {
+		for k := range ops {
+			if !operators[k] {
+				ok = false
+				break
+			}
+		}
+	}
+	if !ok {
+		ops = map[string]interface{}{"eq": x}
+	}
+
+	for op, x := range ops {
+		if op == "exists" {
+			if found != (x == true) {
+				return fmt.Errorf("exists is %t", found)
+			}
+			continue
+		}
+		if !found {
+			return fmt.Errorf("not found")
+		}
+
+		var ok bool
+		switch op {
+		case "eq":
+			ok = equal(a, x)
+		case "ne":
+			ok = !equal(a, x)
+		case "gt", "ge", "lt", "le":
+			fa, oka := toNumber(a)
+			fx, okx := toNumber(x)
+			ok = oka && okx && (op == "gt" && fa > fx || op == "ge" && fa >= fx ||
+				op == "lt" && fa < fx || op == "le" && fa <= fx)
+		case "contains":
+			switch a := a.(type) {
+			case string:
+				ok = strings.Contains(a, fmt.Sprint(x))
+			case []interface{}:
+				for _, v := range a {
+					if equal(v, x) {
+						ok = true
+						break
+					}
+				}
+			}
+		case "match":
+			re, e := regexp.Compile(fmt.Sprint(x))
+			if e != nil {
+				return fmt.Errorf("invalid pattern: %s", e)
+			}
+			ok = re.MatchString(fmt.Sprint(a))
+		}
+		if !ok {
+			b, _ := json.Marshal(a)
+			c, _ := json.Marshal(x)
+			return fmt.Errorf("%s is not %s %s", b, op, c)
+		}
+	}
+	return nil
+}
+
+func equal(a, x interface{}) bool {
+	if na, ok := toInteger(a); ok {
+		if nx, ok := toInteger(x); ok {
+			return na == nx
+		}
+	}
+	if fa, ok := toNumber(a); ok {
+		fx, ok := toNumber(x)
+		return ok && fa == fx
+	}
+	if reflect.DeepEqual(a, x) {
+		return true
+	}
+	b, _ := json.Marshal(a)
+	c, _ := json.Marshal(x)
+	return bytes.Equal(b, c)
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, e := v.Float64()
+		return f, e == nil
+	}
+	return 0, false
+}
+
+// toInteger returns non-negative integer value without loss such as SEID
+func toInteger(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case float64:
+		if v >= 0 && v < 1<<64 && v == float64(uint64(v)) {
+			return uint64(v), true
+		}
+	case int:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	case uint64:
+		return v, true
+	case json.Number:
+		n, e := strconv.ParseUint(v.String(), 10, 64)
+		return n, e == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	res := map[string]interface{}{
+		"status": 201,
+		"body": map[string]interface{}{
+			"PDR": []interface{}{
+				map[string]interface{}{"FTEID": map[string]interface{}{"ID": json.Number("10")}}},
+			"null": nil}}
+	for _, c := range []struct {
+		path string
+		exp  interface{}
+		ok   bool
+	}{
+		{"status", 201, true},
+		{"body.PDR.0.FTEID.ID", json.Number("10"), true},
+		{"body.null", nil, true},
+		{"body.PDR.1", nil, false},
+		{"body.PDR.-1", nil, false},
+		{"body.PDR.x", nil, false},
+		{"body.unknown", nil, false},
+		{"status.code", nil, false},
+	} {
+		v, ok := lookup(res, c.path)
+		if ok != c.ok || !reflect.DeepEqual(v, c.exp) {
+			t.Errorf("%s: lookup is %#v %t, expected %#v %t", c.path, v, ok, c.exp, c.ok)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	r := &runner{vars: map[string]interface{}{
+		"id":   json.Number("18446744073709551615"),
+		"seid": float64(1 << 60),
+		"teid": int64(255),
+		"name": "upf",
+		"pdr":  []interface{}{int64(1)},
+		"neg":  float64(-1)}}
+	for _, c := range []struct {
+		in  interface{}
+		exp interface{}
+	}{
+		{"${id}", json.Number("18446744073709551615")},
+		{"${pdr}", []interface{}{int64(1)}},
+		{"${unknown}", "${unknown}"},
+		{"/session/${id:x}", "/session/ffffffffffffffff"},
+		{"${seid:x}", "1000000000000000"},
+		{"${teid:x}-${name}", "ff-upf"},
+		{"${neg:x}", "-1"},
+		{"${name:x}", "upf"},
+		{"pdr=${pdr}", "pdr=[1]"},
+		{"${name}/${unknown}", "upf/${unknown}"},
+		{int64(1), int64(1)},
+		{map[string]interface{}{"a": []interface{}{"${name}", "${teid}"}},
+			map[string]interface{}{"a": []interface{}{"upf", int64(255)}}},
+	} {
+		if v := r.expand(c.in); !reflect.DeepEqual(v, c.exp) {
+			t.Errorf("%v: expanded to %#v, expected %#v", c.in, v, c.exp)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	for _, c := range []struct {
+		a, x interface{}
+		exp  bool
+	}{
+		{200, int64(200), true},
+		{json.Number("200"), float64(200), true},
+		{json.Number("1.5"), 1.5, true},
+		{json.Number("18446744073709551615"), uint64(18446744073709551615), true},
+		// differs only above 2^53
+		{json.Number("9007199254740993"), int64(9007199254740992), false},
+		{json.Number("9007199254740993"), uint64(9007199254740993), true},
+		{"200", 200, false},
+		{"a", "a", true},
+		{nil, nil, true},
+		{true, false, false},
+		{map[string]interface{}{"a": json.Number("1")},
+			map[string]interface{}{"a": int64(1)}, true},
+		{[]interface{}{"x"}, []interface{}{"y"}, false},
+	} {
+		if v := equal(c.a, c.x); v != c.exp {
+			t.Errorf("equal(%#v, %#v) is %t", c.a, c.x, v)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	type ops = map[string]interface{}
+	for _, c := range []struct {
+		a     interface{}
+		found bool
+		x     interface{}
+		ok    bool
+	}{
+		{json.Number("201"), true, int64(201), true},
+		{json.Number("201"), true, int64(200), false},
+		{nil, false, int64(200), false},
+		{200, true, ops{"lt": int64(400)}, true},
+		{404, true, ops{"lt": int64(400)}, false},
+		{200, true, ops{"ge": int64(200), "le": 200.0}, true},
+		{200, true, ops{"gt": int64(100), "ne": int64(200)}, false},
+		{"x", true, ops{"gt": int64(1)}, false},
+		{nil, false, ops{"exists": false}, true},
+		{nil, false, ops{"exists": true}, false},
+		{nil, true, ops{"exists": true}, true},
+		{"session is deleted", true, ops{"contains": "deleted"}, true},
+		{[]interface{}{json.Number("1"), "a"}, true, ops{"contains": int64(1)}, true},
+		{[]interface{}{"a"}, true, ops{"contains": "b"}, false},
+		{json.Number("12"), true, ops{"match": "^1[0-9]$"}, true},
+		{"abc", true, ops{"match": "("}, false},
+		// map with other keys is compared as value
+		{map[string]interface{}{"lt": 1, "b": 2}, true,
+			ops{"lt": int64(1), "b": int64(2)}, true},
+	} {
+		if e := assert(c.a, c.found, c.x); (e == nil) != c.ok {
+			t.Errorf("assert(%#v, %t, %#v) returns %v", c.a, c.found, c.x, e)
+		}
+	}
+}
@@ -4,43 +4,63 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
 	"log"
 	"net"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/fkgi/harico/pcap"
+	"github.com/fkgi/harico/pfcp"
 )
 
 var (
 	con     *net.UDPConn
 	tun     = make(map[uint64]*session)
+	tunLock sync.RWMutex // guards tun and pdus
 	seq     = make(chan uint32, 1)
 	txStack = make(map[uint32]chan Message)
+	txLock  sync.Mutex // guards txStack
+
+	errPendingSequence = fmt.Errorf("sequence number is already pending")
+
+	capture *pcap.Writer
+
+	peerNode string
 
 	recovery = time.Now()
-	waitTime = time.Second * 3
-	hbTime   = time.Second * 60
+	waitTime = defaultWaitTime
+	hbTime   = defaultHBTime
+)
+
+const (
+	defaultWaitTime = time.Second * 3
+	defaultHBTime   = time.Second * 60
 )
 
 type session struct {
 	seid    uint64
-	nodeid  string
+	nodeid  string // Node ID of the peer which has the session
+	csid    *FQCSID
+	upCSID  *FQCSID
 	rxStack chan ReportRequest
+	report  *ReportResponse
+	rules   ruleSet
 }
 
-// Message of PFCP
-type Message struct {
-	MessageType byte
-	SessionID   uint64
-	Sequence    uint32
-	Priority    byte
-	IEs         []IE
+// lookupSession returns the session of the local SEID
+func lookupSession(id uint64) (*session, bool) {
+	tunLock.RLock()
+	defer tunLock.RUnlock()
+	t, ok := tun[id]
+	return t, ok
 }
 
+// Message of PFCP
+type Message = pfcp.Message
+
 // IE of PFCP
-type IE struct {
-	IEType uint16
-	Data   []byte
-}
+type IE = pfcp.IE
 
 func writeMessage(data []byte) (Message, error) {
 	l := len(data) - 4
@@ -49,8 +69,6 @@ func writeMessage(data []byte) (Message, error) {
 
 	q := <-seq
 	seq <- q + 1
-	ch := make(chan Message)
-	txStack[q] = ch
 	if data[0] == 0x20 {
 		data[4] = byte(q >> 16)
 		data[5] = byte(q >> 8)
@@ -61,110 +79,89 @@ func writeMessage(data []byte) (Message, error) {
 		data[14] = byte(q)
 	}
 
-	log.Printf("Tx PFCP: request")
-	_, e := con.Write(data)
-	if e != nil {
-		log.Printf("Tx PFCP: failed to write: %s", e)
-		delete(txStack, q)
-		return Message{}, e
+	return sendMessage(data, q)
+}
+
+// sendMessage writes data as is and waits response of the sequence q.
+// The request is retransmitted on timeout up to retries times.
+func sendMessage(data []byte, q uint32) (Message, error) {
+	ch := make(chan Message, 1)
+	txLock.Lock()
+	if _, ok := txStack[q]; ok {
+		txLock.Unlock()
+		log.Printf("Tx PFCP: failed to write: %s", errPendingSequence)
+		return Message{}, errPendingSequence
 	}
+	txStack[q] = ch
+	txLock.Unlock()
+	defer func() {
+		txLock.Lock()
+		delete(txStack, q)
+		txLock.Unlock()
+	}()
+
+	confLock.RLock()
+	retries, waitTime := retries, waitTime
+	confLock.RUnlock()
+
+	var m Message
+	for i := 0; m.MessageType == 0; i++ {
+		if i == 0 {
+			log.Printf("Tx PFCP: request")
+		} else if i <= retries {
+			log.Printf("Tx PFCP: retransmit request (%d/%d)", i, retries)
+		} else {
+			e := fmt.Errorf("request timeout")
+			log.Printf("Tx PFCP: failed to write: %s", e)
+			return m, e
+		}
+		if e := writeData(data); e != nil {
+			log.Printf("Tx PFCP: failed to write: %s", e)
+			return m, e
+		}
 
-	t := time.AfterFunc(waitTime, func() {
-		ch <- Message{}
-	})
-	m := <-ch
-	t.Stop()
+		select {
+		case m = <-ch:
+		case <-time.After(waitTime):
+		}
+	}
 
-	if m.MessageType == 0 {
-		e = fmt.Errorf("request timeout")
-		log.Printf("Tx PFCP: failed to write: %s", e)
-	} else if m.MessageType != data[1]+1 {
+	var e error
+	if m.MessageType != data[1]+1 {
 		e = fmt.Errorf("invalid message (type=%d) from peer", m.MessageType)
 	}
-
 	return m, e
 }
 
 func readMessage() {
 	data := make([]byte, 65536)
-	var n uint16
 
 	for {
 		l, e := con.Read(data)
 		if e != nil {
 			break
 		}
-		buf := bytes.NewReader(data[:l])
-		var flg byte
 
-		if flg, e = buf.ReadByte(); e != nil {
-			log.Printf("Rx PFCP: failed to read header option: %s", e)
-			continue
-		}
-		if flg != 0x20 && flg != 0x21 {
-			log.Printf("Rx PFCP: invalid header options %d", flg)
-			continue
+		if e = capture.WriteUDP(
+			peerAddr(con.RemoteAddr()), peerAddr(con.LocalAddr()), data[:l]); e != nil {
+			log.Printf("Rx PFCP: failed to capture: %s", e)
 		}
 
-		m := Message{}
-		if m.MessageType, e = buf.ReadByte(); e != nil {
-			log.Printf("Rx PFCP: failed to read message type: %s", e)
+		m, e := pfcp.Parse(data[:l])
+		if e != nil {
+			log.Printf("Rx PFCP: %s", e)
 			continue
 		}
+		traceMessage("Rx", m)
+
 		switch m.MessageType {
-		case 1, 2, 4, 6, 8, 10, 11, 12:
+		case 1, 2, 4, 6, 8, 10, 11, 12, 14, 15, 17:
 		case 51, 53, 55, 56:
 		default:
 			log.Printf("Rx PFCP: unsupported message type: %d", m.MessageType)
 			continue
 		}
 
-		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
-			log.Printf("Rx PFCP: failed to read message length: %s", e)
-			continue
-		}
-		if int(n) != buf.Len() {
-			log.Printf("Rx PFCP: invalid message length value: %d", n)
-			continue
-		}
-
-		if flg&0x01 == 0x01 {
-			if e = binary.Read(buf, binary.BigEndian, &m.SessionID); e != nil {
-				log.Printf("Rx PFCP: failed to read session ID: %s", e)
-				continue
-			}
-		}
-		if e = binary.Read(buf, binary.BigEndian, &m.Sequence); e != nil {
-			log.Printf("Rx PFCP: failed to read message sequence: %s", e)
-			continue
-		}
-		m.Priority = byte(m.Sequence>>4) & 0x0f
-		m.Sequence = m.Sequence >> 8
-
-		m.IEs = []IE{}
-		for buf.Len() > 0 {
-			ie := IE{}
-			if e = binary.Read(buf, binary.BigEndian, &ie.IEType); e != nil {
-				break
-			}
-			if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
-				break
-			}
-			ie.Data = make([]byte, int(n))
-			if l, e = buf.Read(ie.Data); e != nil {
-				break
-			}
-			if l != len(ie.Data) {
-				e = io.ErrUnexpectedEOF
-				break
-			}
-			m.IEs = append(m.IEs, ie)
-		}
-		if e != nil {
-			log.Printf("Rx PFCP: failed to read IEs: %s", e)
-			continue
-		}
-
 		switch m.MessageType {
 		case 1:
 			log.Printf("Rx PFCP: heartbeat request")
@@ -172,19 +169,47 @@ func readMessage() {
 		case 12:
 			log.Printf("Rx PFCP: node report request")
 			// NodeReport handling
+		case 14:
+			log.Printf("Rx PFCP: session set deletion request")
+			handleSetDeletion(m)
 		case 56:
 			log.Printf("Rx PFCP: session report request")
 			handleSessionReport(m)
 		default:
 			log.Printf("Rx PFCP: response")
-			if ch, ok := txStack[m.Sequence]; ok {
-				ch <- m
+			txLock.Lock()
+			ch, ok := txStack[m.Sequence]
+			txLock.Unlock()
+			if ok {
+				// response to retransmitted request is discarded
+				select {
+				case ch <- m:
+				default:
+				}
 			}
 		}
 	}
 	return
 }
 
+// writeData writes data to the peer without waiting response
+func writeData(data []byte) error {
+	if m, e := pfcp.Parse(data); e == nil {
+		traceMessage("Tx", m)
+	}
+	if e := capture.WriteUDP(
+		peerAddr(con.LocalAddr()), peerAddr(con.RemoteAddr()), data); e != nil {
+		log.Printf("Tx PFCP: failed to capture: %s", e)
+	}
+	_, e := con.Write(data)
+	return e
+}
+
+func peerAddr(a net.Addr) *net.UDPAddr {
+	u, _ := a.(*net.UDPAddr)
+	return u
+}
+
 func dialPFCP(laddr, raddr string) (e error) {
 	var ra, la *net.UDPAddr
 	if la, e = net.ResolveUDPAddr("udp", laddr); e != nil {
@@ -224,12 +249,24 @@ func dialPFCP(laddr, raddr string) (e error) {
 		switch ie.IEType {
 		case 19:
 			if ie.Data[0] != 1 {
-				e = fmt.Errorf("failure response %d", ie.Data[0])
+				e = fmt.Errorf("failure response %d (%s)",
+					ie.Data[0], Cause(ie.Data[0]))
+				con.Close()
+				return
+			}
+		case 60:
+			if peerNode, e = pfcp.DecodeNodeID(ie.Data); e != nil {
+				e = fmt.Errorf("invalid Node ID of peer: %s", e)
 				con.Close()
 				return
 			}
 		}
 	}
+	if len(peerNode) == 0 {
+		peerNode = con.RemoteAddr().(*net.UDPAddr).IP.String()
+		log.Printf("Rx PFCP: no Node ID in response, %s is used", peerNode)
+	}
+	log.Printf("PFCP association with %s is established", peerNode)
 
 	go heartbeat()
 
@@ -237,22 +274,24 @@ func dialPFCP(laddr, raddr string) (e error) {
 }
 
 func heartbeat() {
-	ticker := time.NewTicker(hbTime)
 	for {
-		select {
-		case <-ticker.C:
-			buf := bytes.NewBuffer([]byte{
-				0x20, 0x01,
-				0x00, 0x00,
-				0x00, 0x00, 0x00, 0x00})
-			recoveryTimeStamp(buf)
-			// a.sourceIPAddress(buf)
-
-			_, e := writeMessage(buf.Bytes())
-			if e != nil {
-				log.Printf("Tx PFCP: heartbeat handling failed: %s", e)
-				return
-			}
+		// interval is read in each loop for reloading config
+		confLock.RLock()
+		t := hbTime
+		confLock.RUnlock()
+		time.Sleep(t)
+
+		buf := bytes.NewBuffer([]byte{
+			0x20, 0x01,
+			0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00})
+		recoveryTimeStamp(buf)
+		// a.sourceIPAddress(buf)
+
+		_, e := writeMessage(buf.Bytes())
+		if e != nil {
+			log.Printf("Tx PFCP: heartbeat handling failed: %s", e)
+			return
 		}
 	}
 }
@@ -269,22 +308,32 @@ func handleHeartbeat(m Message) {
 	data[2] = byte(l >> 8)
 	data[3] = byte(l)
 
-	_, e := con.Write(data)
+	e := writeData(data)
 	if e != nil {
 		log.Printf("Rx PFCP: heartbeat handling failed: %s", e)
 	}
 }
 
 func closePFCP() {
+	tunLock.RLock()
+	seids := make(map[uint64]uint64, len(tun)) // local SEID -> remote SEID
 	for id, t := range tun {
+		seids[id] = t.seid
+	}
+	tunLock.RUnlock()
+
+	for id, seid := range seids {
 		buf := bytes.NewBuffer([]byte{
 			0x21, 0x36,
 			0x00, 0x00})
-		binary.Write(buf, binary.BigEndian, t.seid)
+		binary.Write(buf, binary.BigEndian, seid)
 		buf.Write([]byte{0x00, 0x00, 0x00, 0x00})
 
 		writeMessage(buf.Bytes())
+		tunLock.Lock()
+		releasePDU(id)
 		delete(tun, id)
+		tunLock.Unlock()
 	}
 
 	buf := bytes.NewBuffer([]byte{
@@ -305,7 +354,12 @@ func closePFCP() {
 func nodeID(b *bytes.Buffer) {
 	b.Write([]byte{0x00, 0x3c})
 
-	if addr, ok := con.LocalAddr().(*net.UDPAddr); !ok {
+	confLock.RLock()
+	n := localNode
+	confLock.RUnlock()
+	if len(n) != 0 {
+		encodeNodeID(n, b)
+	} else if addr, ok := con.LocalAddr().(*net.UDPAddr); !ok {
 		b.Write([]byte{0x00, 0x00})
 	} else if ip := addr.IP.To4(); ip != nil {
 		b.Write([]byte{0x00, 0x05, 0x00})
@@ -318,6 +372,52 @@ func nodeID(b *bytes.Buffer) {
 	}
 }
 
+// encodeNodeID writes length and value of Node ID IE,
+// n is IP address or FQDN
+func encodeNodeID(n string, b *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	if ip := net.ParseIP(n); ip == nil {
+		buf.WriteByte(0x02)
+		for _, l := range strings.Split(strings.TrimSuffix(n, "."), ".") {
+			buf.WriteByte(byte(len(l)))
+			buf.WriteString(l)
+		}
+	} else if ip4 := ip.To4(); ip4 != nil {
+		buf.WriteByte(0x00)
+		buf.Write(ip4)
+	} else {
+		buf.WriteByte(0x01)
+		buf.Write(ip.To16())
+	}
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// checkNodeID returns error if n is neither IP address nor valid FQDN.
+// FQDN is up to 255 octets in encoded form, labels are up to 63 octets of
+// letters, digits and hyphens, and do not start or end with hyphen.
+func checkNodeID(n string) error {
+	if net.ParseIP(n) != nil {
+		return nil
+	}
+	n = strings.TrimSuffix(n, ".")
+	if len(n)+2 > 255 {
+		return fmt.Errorf("too long node ID %s", n)
+	}
+	for _, l := range strings.Split(n, ".") {
+		if len(l) == 0 || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return fmt.Errorf("invalid node ID %s", n)
+		}
+		for _, c := range l {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+				c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid character %q in node ID %s", c, n)
+			}
+		}
+	}
+	return nil
+}
+
 func recoveryTimeStamp(b *bytes.Buffer) {
 	d := recovery.Sub(time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC))
 	d /= 1000000000
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckNodeID(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	for _, c := range []struct {
+		n  string
+		ok bool
+	}{
+		{"192.0.2.1", true},
+		{"2001:db8::1", true},
+		{"smf.example.com", true},
+		{"smf.example.com.", true},
+		{"upf-1.Example.COM", true},
+		{label + ".com", true},
+		{label + "a.com", false},
+		{"smf..com", false},
+		{"-smf.com", false},
+		{"smf-.com", false},
+		{"smf_1.com", false},
+		{"smf.com/x", false},
+		{"smf com", false},
+		// 253 octets without trailing dot is the longest
+		{strings.Repeat(label+".", 3) + label[:61], true},
+		{strings.Repeat(label+".", 3) + label[:61] + ".", true},
+		{strings.Repeat(label+".", 3) + label[:62], false},
+	} {
+		if e := checkNodeID(c.n); (e == nil) != c.ok {
+			t.Errorf("%q: checkNodeID returns %v", c.n, e)
+		}
+	}
+}
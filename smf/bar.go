@@ -3,18 +3,24 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 )
 
 // CreateBAR IE
 type CreateBAR struct {
 	ID         byte `json:"ID"`
+	DDNDelay   byte `json:"notificationDelay,omitempty"`
 	BufPackets byte `json:"bufferingPacketsCount,omitempty"`
+	// MT-EDT Control Information
 }
 
 func (ie CreateBAR) encode(b *bytes.Buffer) {
 	binary.Write(b, binary.BigEndian, uint16(85))
 	buf := bytes.NewBuffer([]byte{0x00, 0x58, 0x00, 0x01, ie.ID})
 
+	if ie.DDNDelay != 0 {
+		buf.Write([]byte{0x00, 0x2e, 0x00, 0x01, ie.DDNDelay})
+	}
 	if ie.BufPackets != 0 {
 		buf.Write([]byte{0x00, 0x8c, 0x00, 0x01, ie.BufPackets})
 	}
@@ -26,13 +32,51 @@ func (ie CreateBAR) encode(b *bytes.Buffer) {
 // UpdateBAR IE
 type UpdateBAR struct {
 	ID         byte `json:"ID"`
+	DDNDelay   byte `json:"notificationDelay,omitempty"`
 	BufPackets byte `json:"bufferingPacketsCount,omitempty"`
+	// MT-EDT Control Information
 }
 
 func (ie UpdateBAR) encode(b *bytes.Buffer) {
 	binary.Write(b, binary.BigEndian, uint16(86))
 	buf := bytes.NewBuffer([]byte{0x00, 0x58, 0x00, 0x01, ie.ID})
 
+	if ie.DDNDelay != 0 {
+		buf.Write([]byte{0x00, 0x2e, 0x00, 0x01, ie.DDNDelay})
+	}
+	if ie.BufPackets != 0 {
+		buf.Write([]byte{0x00, 0x8c, 0x00, 0x01, ie.BufPackets})
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// ReportUpdateBAR indicate Update BAR IE within Session Report Response
+type ReportUpdateBAR struct {
+	ID            byte    `json:"ID"`
+	DDNDelay      byte    `json:"notificationDelay,omitempty"`
+	BufDuration   *uint32 `json:"bufferingDuration,omitempty"`
+	BufSuggestion uint16  `json:"bufferingSuggestedPacketCount,omitempty"`
+	BufPackets    byte    `json:"bufferingPacketsCount,omitempty"`
+}
+
+func (ie ReportUpdateBAR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(12))
+	buf := bytes.NewBuffer([]byte{0x00, 0x58, 0x00, 0x01, ie.ID})
+
+	if ie.DDNDelay != 0 {
+		buf.Write([]byte{0x00, 0x2e, 0x00, 0x01, ie.DDNDelay})
+	}
+	if ie.BufDuration != nil {
+		buf.Write([]byte{0x00, 0x2f, 0x00, 0x01, encodeTimer(*ie.BufDuration)})
+	}
+	if ie.BufSuggestion > 0xff {
+		buf.Write([]byte{0x00, 0x30, 0x00, 0x02})
+		binary.Write(buf, binary.BigEndian, ie.BufSuggestion)
+	} else if ie.BufSuggestion != 0 {
+		buf.Write([]byte{0x00, 0x30, 0x00, 0x01, byte(ie.BufSuggestion)})
+	}
 	if ie.BufPackets != 0 {
 		buf.Write([]byte{0x00, 0x8c, 0x00, 0x01, ie.BufPackets})
 	}
@@ -53,3 +97,41 @@ func (ie RemoveBAR) encode(b *bytes.Buffer) {
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
 }
+
+// encodeTimer returns timer unit and value of seconds
+// with minimum unit that can hold the duration.
+// The timer is infinite if the duration exceeds 31 * 10 hours.
+func encodeTimer(sec uint32) byte {
+	switch {
+	case sec <= 2*31 && sec%2 == 0:
+		return 0x00 | byte(sec/2)
+	case sec <= 60*31:
+		return 0x20 | byte((sec+59)/60)
+	case sec <= 600*31:
+		return 0x40 | byte((sec+599)/600)
+	case sec <= 3600*31:
+		return 0x60 | byte((sec+3599)/3600)
+	case sec <= 36000*31:
+		return 0x80 | byte((sec+35999)/36000)
+	}
+	return 0xe0
+}
+
+// decodeTimer returns seconds of timer unit and value.
+// Infinite timer is returned as math.MaxUint32.
+func decodeTimer(b byte) uint32 {
+	v := uint32(b & 0x1f)
+	switch b >> 5 {
+	case 0:
+		return v * 2
+	case 2:
+		return v * 600
+	case 3:
+		return v * 3600
+	case 4:
+		return v * 36000
+	case 7:
+		return math.MaxUint32
+	}
+	return v * 60
+}
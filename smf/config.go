@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fkgi/harico/config"
+	"github.com/fkgi/harico/gtpu"
+)
+
+var (
+	confPath  string
+	confFlags = make(map[string]bool) // flags given in command line
+	retries   = 0
+	localNode = ""
+	dualStack net.IP // address of other family for dual-stack F-SEID
+	templates = make(map[string]json.RawMessage)
+	pduConf   = TunnelConfig{}
+
+	// confLock guards parameters updated by applyConfig
+	confLock sync.RWMutex
+)
+
+// Config of SMF.
+// Local, Remote, API and GNB are applied only at start up.
+type Config struct {
+	Local     string                     `json:"local,omitempty"`
+	Remote    string                     `json:"remote,omitempty"`
+	NodeID    string                     `json:"nodeID,omitempty"`
+	DualStack string                     `json:"dualStack,omitempty"`
+	API       string                     `json:"api,omitempty"`
+	Heartbeat config.Duration            `json:"heartbeat,omitempty"`
+	Response  config.Duration            `json:"response,omitempty"`
+	Retries   int                        `json:"retries,omitempty"`
+	Verbose   bool                       `json:"verbose,omitempty"`
+	GNB       []string                   `json:"gNB,omitempty"`
+	Tunnel    TunnelConfig               `json:"tunnel,omitempty"`
+	Templates map[string]json.RawMessage `json:"templates,omitempty"`
+}
+
+// TunnelConfig is GTP-U defaults of built-in gNB
+type TunnelConfig struct {
+	Echo   config.Duration `json:"echo,omitempty"`
+	Device string          `json:"device,omitempty"`
+	FlowID *byte           `json:"flowID,omitempty"`
+}
+
+func loadConfig() (c Config, e error) {
+	if len(confPath) == 0 {
+		return
+	}
+	if e = config.Load(confPath, &c); e != nil {
+		return
+	}
+	if c.Heartbeat < 0 || c.Response < 0 || c.Tunnel.Echo < 0 {
+		e = fmt.Errorf("negative timer value")
+	} else if c.Retries < 0 {
+		e = fmt.Errorf("negative retry count")
+	} else if c.Tunnel.FlowID != nil && *c.Tunnel.FlowID > 63 {
+		e = fmt.Errorf("invalid QoS flow ID %d", *c.Tunnel.FlowID)
+	} else if len(c.DualStack) != 0 && net.ParseIP(c.DualStack) == nil {
+		e = fmt.Errorf("invalid dual-stack address %s", c.DualStack)
+	} else if len(c.NodeID) != 0 {
+		e = checkNodeID(c.NodeID)
+	}
+	if a, ok := n4Remote(); ok && e == nil && !confFlags["d"] {
+		e = checkDualStack(net.ParseIP(c.DualStack), a.IP)
+	}
+	for n, t := range c.Templates {
+		if e != nil {
+			break
+		}
+		if e = json.Unmarshal(t, &EstablishmentRequest{}); e != nil {
+			e = fmt.Errorf("invalid template %s: %s", n, e)
+		}
+	}
+	return
+}
+
+// applyConfig updates parameters which can be changed in runtime.
+// Parameters given in command line are not changed,
+// and parameters omitted in c are reset to default.
+func applyConfig(c Config) {
+	gtpu.SetTimeEcho(time.Duration(c.Tunnel.Echo))
+
+	confLock.Lock()
+	defer confLock.Unlock()
+	if !confFlags["h"] {
+		hbTime = time.Duration(c.Heartbeat)
+		if hbTime == 0 {
+			hbTime = defaultHBTime
+		}
+	}
+	waitTime = time.Duration(c.Response)
+	if waitTime == 0 {
+		waitTime = defaultWaitTime
+	}
+	if !confFlags["v"] {
+		verbose = c.Verbose
+	}
+	retries = c.Retries
+	if !confFlags["n"] {
+		localNode = c.NodeID
+	}
+	if !confFlags["d"] {
+		dualStack = net.ParseIP(c.DualStack)
+	}
+	pduConf = c.Tunnel
+	templates = c.Templates
+	if templates == nil {
+		templates = make(map[string]json.RawMessage)
+	}
+}
+
+// n4Remote returns remote address of N4 if PFCP is already dialed
+func n4Remote() (*net.UDPAddr, bool) {
+	if con == nil {
+		return nil, false
+	}
+	a, ok := con.RemoteAddr().(*net.UDPAddr)
+	return a, ok
+}
+
+// checkDualStack returns error if the dual-stack address ds is
+// the same family as N4 address n4, which overwrites N4 address in F-SEID
+func checkDualStack(ds, n4 net.IP) error {
+	if ds != nil && n4 != nil && (ds.To4() != nil) == (n4.To4() != nil) {
+		return fmt.Errorf(
+			"dual-stack address %s is the same family as N4 address %s", ds, n4)
+	}
+	return nil
+}
+
+func reloadConfig() {
+	c, e := loadConfig()
+	if e != nil {
+		log.Printf("failed to reload config: %s", e)
+		return
+	}
+	applyConfig(c)
+	log.Printf("config is reloaded from %s", confPath)
+}
+
+// sessionTemplate returns copy of the template given by query parameter
+func sessionTemplate(r *http.Request) (d EstablishmentRequest, e error) {
+	n := r.URL.Query().Get("template")
+	if len(n) == 0 {
+		return
+	}
+	confLock.RLock()
+	t, ok := templates[n]
+	confLock.RUnlock()
+	if !ok {
+		e = fmt.Errorf("unknown template %s", n)
+		return
+	}
+	e = json.Unmarshal(t, &d)
+	return
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fkgi/harico/config"
+)
+
+func TestApplyConfigReset(t *testing.T) {
+	defer applyConfig(Config{})
+
+	applyConfig(Config{
+		Heartbeat: config.Duration(time.Second),
+		Response:  config.Duration(time.Second),
+		Retries:   2})
+	if hbTime != time.Second || waitTime != time.Second || retries != 2 {
+		t.Fatalf("applied heartbeat=%s response=%s retries=%d", hbTime, waitTime, retries)
+	}
+
+	// omitted parameters are reset to default
+	applyConfig(Config{})
+	if hbTime != defaultHBTime || waitTime != defaultWaitTime || retries != 0 {
+		t.Errorf("reset heartbeat=%s response=%s retries=%d", hbTime, waitTime, retries)
+	}
+}
@@ -12,7 +12,7 @@ type CreateFAR struct {
 	Action     Action               `json:"action"`
 	Forwarding *ForwardingParameter `json:"forwardingParam,omitempty"`
 	BAR        byte                 `json:"BAR,omitempty"`
-	// Redundant Transmission Parameters
+	Redundant  *RedundantForwarding `json:"redundant,omitempty"`
 }
 
 func (ie CreateFAR) encode(b *bytes.Buffer) {
@@ -27,6 +27,9 @@ func (ie CreateFAR) encode(b *bytes.Buffer) {
 	if ie.BAR != 0 {
 		buf.Write([]byte{0x00, 0x58, 0x00, 0x01, ie.BAR})
 	}
+	if ie.Redundant != nil {
+		ie.Redundant.encode(buf)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -38,7 +41,7 @@ type UpdateFAR struct {
 	Action     *Action                    `json:"action,omitempty"`
 	Forwarding *UpdateForwardingParameter `json:"forwardingParam,omitempty"`
 	BAR        byte                       `json:"BAR,omitempty"`
-	// Redundant Transmission Parameters
+	Redundant  *RedundantForwarding       `json:"redundant,omitempty"`
 }
 
 func (ie UpdateFAR) encode(b *bytes.Buffer) {
@@ -55,6 +58,9 @@ func (ie UpdateFAR) encode(b *bytes.Buffer) {
 	if ie.BAR != 0 {
 		buf.Write([]byte{0x00, 0x58, 0x00, 0x01, ie.BAR})
 	}
+	if ie.Redundant != nil {
+		ie.Redundant.encode(buf)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -178,7 +184,7 @@ type UpdateForwardingParameter struct {
 	TransportMarking byte            `json:"transportMarking,omitempty"`
 	// Forwarding Policy
 	// Header Enrichment
-	// PFCPSMReq-Flags
+	Flags *PFCPSMReqFlags `json:"flags,omitempty"`
 	// Linked Traffic Endpoint ID
 	// Destination Interface Type
 }
@@ -201,6 +207,30 @@ func (ie UpdateForwardingParameter) encode(b *bytes.Buffer) {
 	if ie.TransportMarking != 0 {
 		b.Write([]byte{0x00, 0x1e, 0x00, 0x02, ie.TransportMarking, 0xfc})
 	}
+	if ie.Flags != nil {
+		ie.Flags.encode(buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// RedundantForwarding is Redundant Transmission Forwarding Parameters IE in FAR
+type RedundantForwarding struct {
+	Header   HeaderCreation `json:"header"`
+	Instance string         `json:"instance,omitempty"`
+}
+
+func (ie RedundantForwarding) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(270))
+	buf := new(bytes.Buffer)
+
+	ie.Header.encode(buf)
+	if len(ie.Instance) != 0 {
+		buf.Write([]byte{0x00, 0x16})
+		binary.Write(buf, binary.BigEndian, uint16(len(ie.Instance)))
+		buf.WriteString(ie.Instance)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"time"
 )
 
 // Interface IE
@@ -224,14 +227,14 @@ func (ie *UEIP) decode(b []byte) (e error) {
 		return
 	}
 	ie.Dest = (flag & 0x04) == 0x04
-	if flag&0x01 == 0x01 {
+	if flag&0x02 == 0x02 {
 		ie.IPv4 = []byte{0, 0, 0, 0}
 		_, e = buf.Read(ie.IPv4)
 		if e != nil {
 			return
 		}
 	}
-	if flag&0x02 == 0x02 {
+	if flag&0x01 == 0x01 {
 		ie.IPv6 = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 		_, e = buf.Read(ie.IPv6)
 		if e != nil {
@@ -253,6 +256,319 @@ func (ie *UEIP) decode(b []byte) (e error) {
 	return
 }
 
+// FSEID indicate F-SEID IE
+type FSEID struct {
+	ID   uint64 `json:"ID,omitempty"`
+	IPv4 net.IP `json:"IPv4,omitempty"`
+	IPv6 net.IP `json:"IPv6,omitempty"`
+}
+
+func (ie FSEID) encode(b *bytes.Buffer) {
+	if ie.IPv4 == nil && ie.IPv6 == nil {
+		sessionID(b, ie.ID)
+		return
+	}
+	buf := bytes.NewBuffer([]byte{0x00, 0x39, 0x00, 0x00, 0x00})
+	binary.Write(buf, binary.BigEndian, ie.ID)
+
+	var flag byte = 0x00
+	if ie.IPv4 != nil {
+		flag = flag | 0x02
+		buf.Write(ie.IPv4.To4())
+	}
+	if ie.IPv6 != nil {
+		flag = flag | 0x01
+		buf.Write(ie.IPv6.To16())
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	data[4] = flag
+	b.Write(data)
+}
+
+// setAddr sets IPv4 or IPv6 address of the F-SEID
+func (ie *FSEID) setAddr(ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ie.IPv4 = ip4
+	} else if ip6 := ip.To16(); ip6 != nil {
+		ie.IPv6 = ip6
+	}
+}
+
+func (ie *FSEID) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	if e = binary.Read(buf, binary.BigEndian, &ie.ID); e != nil {
+		return
+	}
+	if flag&0x02 == 0x02 {
+		ie.IPv4 = make(net.IP, net.IPv4len)
+		if _, e = io.ReadFull(buf, ie.IPv4); e != nil {
+			return
+		}
+	}
+	if flag&0x01 == 0x01 {
+		ie.IPv6 = make(net.IP, net.IPv6len)
+		if _, e = io.ReadFull(buf, ie.IPv6); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// FQCSID IE
+type FQCSID struct {
+	IPv4   net.IP   `json:"IPv4,omitempty"`
+	IPv6   net.IP   `json:"IPv6,omitempty"`
+	Global *uint32  `json:"global,omitempty"` // MCC/MNC based node ID
+	CSID   []uint16 `json:"CSID,omitempty"`
+}
+
+func (ie FQCSID) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer([]byte{0x00, 0x41, 0x00, 0x00, 0x00})
+
+	var flag byte
+	if ie.IPv4 != nil {
+		buf.Write(ie.IPv4.To4())
+	} else if ie.IPv6 != nil {
+		flag = 0x10
+		buf.Write(ie.IPv6.To16())
+	} else if ie.Global != nil {
+		flag = 0x20
+		binary.Write(buf, binary.BigEndian, *ie.Global)
+	}
+	for _, id := range ie.CSID {
+		binary.Write(buf, binary.BigEndian, id)
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	data[4] = flag | byte(len(ie.CSID)&0x0f)
+	b.Write(data)
+}
+
+func (ie *FQCSID) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	switch flag >> 4 {
+	case 0:
+		ie.IPv4 = make([]byte, 4)
+		_, e = io.ReadFull(buf, ie.IPv4)
+	case 1:
+		ie.IPv6 = make([]byte, 16)
+		_, e = io.ReadFull(buf, ie.IPv6)
+	case 2:
+		ie.Global = new(uint32)
+		e = binary.Read(buf, binary.BigEndian, ie.Global)
+	default:
+		e = fmt.Errorf("invalid node ID type %d", flag>>4)
+	}
+	if e != nil {
+		return
+	}
+	ie.CSID = make([]uint16, flag&0x0f)
+	e = binary.Read(buf, binary.BigEndian, ie.CSID)
+	return
+}
+
+// match returns true if node address of the FQ-CSIDs are same and
+// any CSID is included in both. No CSID in p means any CSID.
+func (ie FQCSID) match(p FQCSID) bool {
+	switch {
+	case p.IPv4 != nil && !p.IPv4.Equal(ie.IPv4):
+		return false
+	case p.IPv6 != nil && !p.IPv6.Equal(ie.IPv6):
+		return false
+	case p.Global != nil && (ie.Global == nil || *p.Global != *ie.Global):
+		return false
+	case len(p.CSID) == 0:
+		return true
+	}
+	for _, i := range ie.CSID {
+		for _, j := range p.CSID {
+			if i == j {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AlternativeIP is Alternative SMF IP Address IE
+type AlternativeIP struct {
+	IPv4 net.IP `json:"IPv4,omitempty"`
+	IPv6 net.IP `json:"IPv6,omitempty"`
+	PPE  bool   `json:"PPE,omitempty"` // preferred PFCP entity
+}
+
+func (ie AlternativeIP) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer([]byte{0x00, 0xb2, 0x00, 0x00, 0x00})
+
+	var flag byte
+	if ie.IPv4 != nil {
+		flag |= 0x02
+		buf.Write(ie.IPv4.To4())
+	}
+	if ie.IPv6 != nil {
+		flag |= 0x01
+		buf.Write(ie.IPv6.To16())
+	}
+	if ie.PPE {
+		flag |= 0x04
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	data[4] = flag
+	b.Write(data)
+}
+
+func (ie *AlternativeIP) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	ie.PPE = flag&0x04 == 0x04
+	if flag&0x02 == 0x02 {
+		ie.IPv4 = make([]byte, 4)
+		if _, e = io.ReadFull(buf, ie.IPv4); e != nil {
+			return
+		}
+	}
+	if flag&0x01 == 0x01 {
+		ie.IPv6 = make([]byte, 16)
+		_, e = io.ReadFull(buf, ie.IPv6)
+	}
+	return
+}
+
+// LoadControlInformation IE
+type LoadControlInformation struct {
+	Sequence uint32 `json:"sequence"`
+	Metric   byte   `json:"metric"`
+}
+
+func (ie *LoadControlInformation) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 52:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Sequence = binary.BigEndian.Uint32(b)
+			}
+		case 53:
+			if len(b) < 1 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Metric = b[0]
+			}
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+// OverloadControlInformation IE
+type OverloadControlInformation struct {
+	Sequence uint32 `json:"sequence"`
+	Metric   byte   `json:"metric"`
+	Timer    uint32 `json:"validityPeriod"`
+	AOCI     bool   `json:"AOCI,omitempty"`
+}
+
+func (ie *OverloadControlInformation) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 52:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Sequence = binary.BigEndian.Uint32(b)
+			}
+		case 53:
+			if len(b) < 1 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Metric = b[0]
+			}
+		case 55:
+			if len(b) < 1 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Timer = decodeTimer(b[0])
+			}
+		case 110:
+			if len(b) < 1 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.AOCI = b[0]&0x01 == 0x01
+			}
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
 func decodeCause(data []byte) byte {
 	if len(data) == 0 {
 		return 0
@@ -260,6 +576,198 @@ func decodeCause(data []byte) byte {
 	return data[0]
 }
 
+// Cause IE
+type Cause byte
+
+func (ie Cause) String() string {
+	switch ie {
+	case 1:
+		return "Request accepted"
+	case 2:
+		return "More Usage Report to send"
+	case 3:
+		return "Request partially accepted"
+	case 64:
+		return "Request rejected"
+	case 65:
+		return "Session context not found"
+	case 66:
+		return "Mandatory IE missing"
+	case 67:
+		return "Conditional IE missing"
+	case 68:
+		return "Invalid length"
+	case 69:
+		return "Mandatory IE incorrect"
+	case 70:
+		return "Invalid Forwarding Policy"
+	case 71:
+		return "Invalid F-TEID allocation option"
+	case 72:
+		return "No established PFCP Association"
+	case 73:
+		return "Rule creation/modification Failure"
+	case 74:
+		return "PFCP entity in congestion"
+	case 75:
+		return "No resources available"
+	case 76:
+		return "Service not supported"
+	case 77:
+		return "System failure"
+	case 78:
+		return "Redirection Requested"
+	case 79:
+		return "All dynamic addresses are occupied"
+	case 80:
+		return "Unknown Pre-defined Rule"
+	case 81:
+		return "Unknown Application ID"
+	case 82:
+		return "L2TP tunnel Establishment failure"
+	case 83:
+		return "L2TP session Establishment failure"
+	case 84:
+		return "L2TP tunnel Release"
+	case 85:
+		return "L2TP session Release"
+	case 86:
+		return "PFCP session restoration failure due to requested SEID already in use"
+	case 87:
+		return "L2TP tunnel Establishment failure - Tunnel Auth failure"
+	case 88:
+		return "L2TP session Establishment failure - Session Auth failure"
+	case 89:
+		return "L2TP tunnel Establishment failure - LNS not reachable"
+	}
+	return fmt.Sprintf("Unknown cause (%d)", byte(ie))
+}
+
+// FailedRuleID IE
+type FailedRuleID struct {
+	Type string `json:"type"`
+	ID   uint32 `json:"ID"`
+}
+
+func (ie *FailedRuleID) decode(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("invalid data")
+	}
+	var l int
+	switch b[0] & 0x1f {
+	case 0:
+		ie.Type, l = "PDR", 2
+	case 1:
+		ie.Type, l = "FAR", 4
+	case 2:
+		ie.Type, l = "QER", 4
+	case 3:
+		ie.Type, l = "URR", 4
+	case 4:
+		ie.Type, l = "BAR", 1
+	case 5:
+		ie.Type, l = "MAR", 2
+	case 6:
+		ie.Type, l = "SRR", 1
+	default:
+		return fmt.Errorf("invalid rule ID type %d", b[0]&0x1f)
+	}
+	if len(b) < l+1 {
+		return fmt.Errorf("invalid data")
+	}
+	for _, v := range b[1 : l+1] {
+		ie.ID = (ie.ID << 8) | uint32(v)
+	}
+	return nil
+}
+
+// causeError is error of non-accepted cause from peer
+type causeError struct {
+	cause    Cause
+	offend   []uint16
+	failRule *FailedRuleID
+}
+
+func (e *causeError) Error() string {
+	return fmt.Sprintf("PFCP error (cause=%d: %s) from peer", e.cause, e.cause)
+}
+
+func (e *causeError) decode(ies []IE) {
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 19:
+			e.cause = Cause(decodeCause(ie.Data))
+		case 40:
+			if len(ie.Data) >= 2 {
+				e.offend = append(e.offend, binary.BigEndian.Uint16(ie.Data))
+			}
+		case 114:
+			r := &FailedRuleID{}
+			if r.decode(ie.Data) == nil {
+				e.failRule = r
+			}
+		}
+	}
+}
+
+// problem returns ProblemDetails of the error.
+// rule returns JSON pointer to the failed rule in the request.
+func (e *causeError) problem(instance string, rule func(FailedRuleID) string) ProblemDetails {
+	p := ProblemDetails{
+		Title:    "PFCP message handling failed",
+		Status:   http.StatusInternalServerError,
+		Detail:   e.Error(),
+		Instance: instance,
+		Cause:    e.cause.String()}
+	for _, t := range e.offend {
+		p.InvalidParams = append(p.InvalidParams, InvalidParam{
+			Param:  ieName(t),
+			Reason: fmt.Sprintf("offending IE (type=%d)", t)})
+	}
+	if e.failRule != nil {
+		param := ""
+		if rule != nil {
+			param = rule(*e.failRule)
+		}
+		if param == "" {
+			param = fmt.Sprintf("%s ID %d", e.failRule.Type, e.failRule.ID)
+		}
+		p.InvalidParams = append(p.InvalidParams, InvalidParam{
+			Param: param,
+			Reason: fmt.Sprintf("failed rule (%s ID=%d)",
+				e.failRule.Type, e.failRule.ID)})
+	}
+	return p
+}
+
 func encodeCause(c byte, b *bytes.Buffer) {
 	b.Write([]byte{0x00, 0x13, 0x00, 0x01, c})
 }
+
+func decodeTimeStamp(data []byte) (*time.Time, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid data")
+	}
+	t := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC).Add(
+		time.Second * time.Duration(binary.BigEndian.Uint32(data)))
+	return &t, nil
+}
+
+func encodeNTPTime(t time.Time, b *bytes.Buffer) {
+	if t.IsZero() {
+		b.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	d := t.Sub(time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC))
+	binary.Write(b, binary.BigEndian, uint32(d/time.Second))
+	binary.Write(b, binary.BigEndian, uint32((uint64(d%time.Second)<<32)/uint64(time.Second)))
+}
+
+func decodeNTPTime(data []byte) *time.Time {
+	s := binary.BigEndian.Uint32(data)
+	f := binary.BigEndian.Uint32(data[4:])
+	t := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC).Add(
+		time.Second*time.Duration(s) +
+			time.Duration((uint64(f)*uint64(time.Second))>>32))
+	return &t
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,6 +17,9 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/fkgi/harico/gtpu"
+	"github.com/fkgi/harico/pcap"
 )
 
 func main() {
@@ -25,23 +30,105 @@ func main() {
 	ra := flag.String("r", "127.0.0.1:8805", "remote addr/port")
 	mg := flag.String("m", ":8080", "management API addr/port")
 	h := flag.Int("h", int(hbTime/time.Second), "heartbeat interval")
+	v := flag.Bool("v", false, "verbose log with decoded PFCP messages")
+	t := flag.String("t", "", "JSON trace file of PFCP messages")
+	pc := flag.String("p", "", "pcap (not pcapng) file of PFCP and built-in gNB GTP-U packets")
+	rp := flag.String("replay", "", "pcap file of PFCP messages to replay")
+	g := flag.String("g", "", "comma separated GTP-U addr/ports of built-in gNB")
+	flag.StringVar(&confPath, "c", "", "YAML/JSON config file, reloaded on SIGHUP")
+	flag.StringVar(&localNode, "n", "", "Node ID (IP address or FQDN), local address if empty")
+	d := flag.String("d", "", "IP address of other family for dual-stack F-SEID")
 	flag.Parse()
 
+	flag.Visit(func(f *flag.Flag) { confFlags[f.Name] = true })
 	hbTime = time.Second * time.Duration(*h)
+	verbose = *v
+	if len(localNode) != 0 {
+		if e := checkNodeID(localNode); e != nil {
+			log.Fatalln(e)
+		}
+	}
+	if len(*d) != 0 {
+		if dualStack = net.ParseIP(*d); dualStack == nil {
+			log.Fatalln("invalid dual-stack address:", *d)
+		}
+	}
+	c, e := loadConfig()
+	if e != nil {
+		log.Fatalf("failed to load config: %s", e)
+	}
+	applyConfig(c)
+	if len(c.Local) != 0 && !confFlags["l"] {
+		*la = c.Local
+	}
+	if len(c.Remote) != 0 && !confFlags["r"] {
+		*ra = c.Remote
+	}
+	if len(c.API) != 0 && !confFlags["m"] {
+		*mg = c.API
+	}
+	if len(c.GNB) != 0 && !confFlags["g"] {
+		*g = strings.Join(c.GNB, ",")
+	}
+	if a, e := net.ResolveUDPAddr("udp", *ra); e == nil {
+		if e = checkDualStack(dualStack, a.IP); e != nil {
+			log.Fatalln(e)
+		}
+	}
+
+	if len(*t) != 0 {
+		f, e := os.OpenFile(*t, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if e != nil {
+			log.Fatalf("failed to open trace file: %s", e)
+		}
+		defer f.Close()
+		traceFile = f
+	}
+	if len(*pc) != 0 {
+		w, e := pcap.Create(*pc)
+		if e != nil {
+			log.Fatalf("failed to create pcap file: %s", e)
+		}
+		defer w.Close()
+		capture = w
+		gtpu.Capture = w
+	}
 	rand.Seed(time.Now().UnixNano())
 
-	e := dialPFCP(*la, *ra)
+	e = dialPFCP(*la, *ra)
 	if e != nil {
 		log.Fatalf("Tx PFCP: faild to setup association: %s", e)
 	}
 
+	if len(*g) != 0 {
+		if e = startGNB(strings.Split(*g, ",")); e != nil {
+			log.Fatalf("GTP local binding failed: %s", e)
+		}
+		defer closeGNB()
+	}
+
 	go func() {
 		log.Fatalln(http.ListenAndServe(*mg, http.Handler(apiHandler)))
 	}()
 
-	sigc := make(chan os.Signal)
-	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sigc
+	if len(*rp) != 0 {
+		ng, e := replayPcap(*rp)
+		closePFCP()
+		if e != nil {
+			log.Fatalf("Replay: failed: %s", e)
+		}
+		if ng != 0 {
+			os.Exit(1)
+		}
+		log.Println("process is stopped")
+		return
+	}
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	for s := <-sigc; s == syscall.SIGHUP; s = <-sigc {
+		reloadConfig()
+	}
 	log.Println("shutting down")
 	closePFCP()
 
@@ -53,8 +140,17 @@ var apiHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(buf, "Rx API:")
 	fmt.Fprintln(buf, " | method: ", r.Method)
 	fmt.Fprintln(buf, " | authority: ", r.URL.String())
-	fmt.Fprintln(buf, " | body:")
-	fmt.Fprintln(buf, " | |", r.Body)
+	if r.Body != nil {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if len(b) != 0 {
+			fmt.Fprintln(buf, " | body:")
+			for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				fmt.Fprintln(buf, " | |", l)
+			}
+		}
+	}
 	log.Print(buf.String())
 
 	p := r.URL.Path
@@ -97,7 +193,7 @@ var apiHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				Status:   http.StatusNotFound,
 				Detail:   "invalid session ID",
 				Instance: r.URL.Path})
-		} else if t, ok := tun[id]; !ok {
+		} else if t, ok := lookupSession(id); !ok {
 			errorResponse(w, ProblemDetails{
 				Title:    "context not found",
 				Status:   http.StatusNotFound,
@@ -120,6 +216,175 @@ var apiHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 					Instance: r.URL.Path})
 			}
 		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/session/*/report", p); b {
+		id, e := strconv.ParseUint(strings.Split(p, "/")[4], 16, 64)
+		if e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "invalid session ID",
+				Instance: r.URL.Path})
+		} else if t, ok := lookupSession(id); !ok {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "no such session",
+				Instance: r.URL.Path})
+		} else {
+			switch r.Method {
+			case http.MethodPut:
+				handleReportPUT(w, r, &t.report, id)
+			case http.MethodGet:
+				handleReportGET(w, r, &t.report)
+			case http.MethodDelete:
+				handleReportDELETE(w, r, &t.report)
+			default:
+				w.Header().Set("allow", "PUT, GET, DELETE")
+				errorResponse(w, ProblemDetails{
+					Title:    "invalid method",
+					Status:   http.StatusMethodNotAllowed,
+					Detail:   "only PUT/GET/DELETE is allowed",
+					Instance: r.URL.Path})
+			}
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/pdu-session", p); b {
+		switch r.Method {
+		case http.MethodPost:
+			handlePDUSessionPOST(w, r)
+		case http.MethodGet:
+			handlePDUSessionLIST(w, r)
+		default:
+			w.Header().Set("allow", "POST, GET")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only POST/GET is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/pdu-session/*", p); b {
+		id, e := strconv.ParseUint(strings.Split(p, "/")[4], 16, 64)
+		if e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "invalid session ID",
+				Instance: r.URL.Path})
+		} else if c, ok := lookupPDU(id); !ok {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "no such PDU session",
+				Instance: r.URL.Path})
+		} else {
+			switch r.Method {
+			case http.MethodGet:
+				handlePDUSessionGET(w, r, c)
+			case http.MethodDelete:
+				handlePDUSessionDELETE(w, r, c, id)
+			default:
+				w.Header().Set("allow", "GET, DELETE")
+				errorResponse(w, ProblemDetails{
+					Title:    "invalid method",
+					Status:   http.StatusMethodNotAllowed,
+					Detail:   "only GET/DELETE is allowed",
+					Instance: r.URL.Path})
+			}
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/pdu-session/*/handover", p); b {
+		id, e := strconv.ParseUint(strings.Split(p, "/")[4], 16, 64)
+		if e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "invalid session ID",
+				Instance: r.URL.Path})
+		} else if c, ok := lookupPDU(id); !ok {
+			errorResponse(w, ProblemDetails{
+				Title:    "context not found",
+				Status:   http.StatusNotFound,
+				Detail:   "no such PDU session",
+				Instance: r.URL.Path})
+		} else {
+			switch r.Method {
+			case http.MethodPost:
+				handleHandoverPOST(w, r, c)
+			default:
+				w.Header().Set("allow", "POST")
+				errorResponse(w, ProblemDetails{
+					Title:    "invalid method",
+					Status:   http.StatusMethodNotAllowed,
+					Detail:   "only POST is allowed",
+					Instance: r.URL.Path})
+			}
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/session-set/deletion", p); b {
+		switch r.Method {
+		case http.MethodPost:
+			handleSetDeletionPOST(w, r)
+		default:
+			w.Header().Set("allow", "POST")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only POST is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/session-set/modification", p); b {
+		switch r.Method {
+		case http.MethodPost:
+			handleSetModificationPOST(w, r)
+		default:
+			w.Header().Set("allow", "POST")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only POST is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/pfd", p); b {
+		switch r.Method {
+		case http.MethodPut:
+			handlePFDPUT(w, r)
+		case http.MethodGet:
+			handlePFDGET(w, r)
+		case http.MethodDelete:
+			handlePFDDELETE(w, r)
+		default:
+			w.Header().Set("allow", "PUT, GET, DELETE")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only PUT/GET/DELETE is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/message", p); b {
+		switch r.Method {
+		case http.MethodPost:
+			handleMessagePOST(w, r)
+		default:
+			w.Header().Set("allow", "POST")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only POST is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-cp/v1/report", p); b {
+		switch r.Method {
+		case http.MethodPut:
+			handleReportPUT(w, r, &reportPolicy, 0)
+		case http.MethodGet:
+			handleReportGET(w, r, &reportPolicy)
+		case http.MethodDelete:
+			handleReportDELETE(w, r, &reportPolicy)
+		default:
+			w.Header().Set("allow", "PUT, GET, DELETE")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only PUT/GET/DELETE is allowed",
+				Instance: r.URL.Path})
+		}
 	} else {
 		errorResponse(w, ProblemDetails{
 			Title:    "context not found",
@@ -138,9 +403,17 @@ func errorResponse(w http.ResponseWriter, p ProblemDetails) {
 
 // ProblemDetails struct
 type ProblemDetails struct {
-	Type     string `json:"type,omitempty"`
-	Title    string `json:"title,omitempty"`
-	Status   int    `json:"status,omitempty"`
-	Detail   string `json:"detail,omitempty"`
-	Instance string `json:"instance,omitempty"`
+	Type          string         `json:"type,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Status        int            `json:"status,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Cause         string         `json:"cause,omitempty"`
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty"`
+}
+
+// InvalidParam struct
+type InvalidParam struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason,omitempty"`
 }
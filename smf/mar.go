@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// CreateMAR IE
+type CreateMAR struct {
+	ID            uint16                `json:"ID"`
+	Functionality SteeringFunctionality `json:"steeringFunctionality"`
+	Mode          SteeringMode          `json:"steeringMode"`
+	Access3GPP    *AccessForwarding     `json:"3GPPAccess,omitempty"`
+	AccessNon3GPP *AccessForwarding     `json:"non3GPPAccess,omitempty"`
+	// Thresholds
+	// Steering Mode Indicator
+}
+
+func (ie CreateMAR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(165))
+	buf := bytes.NewBuffer([]byte{0x00, 0xaa, 0x00, 0x02})
+	binary.Write(buf, binary.BigEndian, ie.ID)
+
+	buf.Write([]byte{0x00, 0xab, 0x00, 0x01, byte(ie.Functionality)})
+	buf.Write([]byte{0x00, 0xac, 0x00, 0x01, byte(ie.Mode)})
+	if ie.Access3GPP != nil {
+		ie.Access3GPP.encode(166, buf)
+	}
+	if ie.AccessNon3GPP != nil {
+		ie.AccessNon3GPP.encode(167, buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// UpdateMAR IE
+type UpdateMAR struct {
+	ID                  uint16                 `json:"ID"`
+	Functionality       *SteeringFunctionality `json:"steeringFunctionality,omitempty"`
+	Mode                *SteeringMode          `json:"steeringMode,omitempty"`
+	UpdateAccess3GPP    *AccessForwarding      `json:"update3GPPAccess,omitempty"`
+	UpdateAccessNon3GPP *AccessForwarding      `json:"updateNon3GPPAccess,omitempty"`
+	Access3GPP          *AccessForwarding      `json:"3GPPAccess,omitempty"`
+	AccessNon3GPP       *AccessForwarding      `json:"non3GPPAccess,omitempty"`
+	// Thresholds
+	// Steering Mode Indicator
+}
+
+func (ie UpdateMAR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(169))
+	buf := bytes.NewBuffer([]byte{0x00, 0xaa, 0x00, 0x02})
+	binary.Write(buf, binary.BigEndian, ie.ID)
+
+	if ie.Functionality != nil {
+		buf.Write([]byte{0x00, 0xab, 0x00, 0x01, byte(*ie.Functionality)})
+	}
+	if ie.Mode != nil {
+		buf.Write([]byte{0x00, 0xac, 0x00, 0x01, byte(*ie.Mode)})
+	}
+	if ie.UpdateAccess3GPP != nil {
+		ie.UpdateAccess3GPP.encode(175, buf)
+	}
+	if ie.UpdateAccessNon3GPP != nil {
+		ie.UpdateAccessNon3GPP.encode(176, buf)
+	}
+	if ie.Access3GPP != nil {
+		ie.Access3GPP.encode(166, buf)
+	}
+	if ie.AccessNon3GPP != nil {
+		ie.AccessNon3GPP.encode(167, buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// RemoveMAR IE
+type RemoveMAR struct {
+	ID uint16 `json:"ID"`
+}
+
+func (ie RemoveMAR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(168))
+	buf := bytes.NewBuffer([]byte{0x00, 0xaa, 0x00, 0x02})
+	binary.Write(buf, binary.BigEndian, ie.ID)
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// AccessForwarding is (Update) 3GPP/Non-3GPP Access Forwarding Action Information IE
+type AccessForwarding struct {
+	FAR      uint32          `json:"FAR,omitempty"`
+	Weight   *byte           `json:"weight,omitempty"`
+	Priority *AccessPriority `json:"priority,omitempty"`
+	URR      []uint32        `json:"URR,omitempty"`
+	// RAT Type
+}
+
+func (ie AccessForwarding) encode(t uint16, b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, t)
+	buf := new(bytes.Buffer)
+
+	if ie.FAR != 0 {
+		buf.Write([]byte{0x00, 0x6c, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.FAR)
+	}
+	if ie.Weight != nil {
+		buf.Write([]byte{0x00, 0xad, 0x00, 0x01, *ie.Weight})
+	}
+	if ie.Priority != nil {
+		buf.Write([]byte{0x00, 0xae, 0x00, 0x01, byte(*ie.Priority)})
+	}
+	for _, urr := range ie.URR {
+		buf.Write([]byte{0x00, 0x51, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, urr)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// SteeringFunctionality IE
+type SteeringFunctionality byte
+
+// MarshalText returns text of ie
+func (ie SteeringFunctionality) MarshalText() ([]byte, error) {
+	switch ie {
+	case 0:
+		return []byte("ATSSS-LL"), nil
+	case 1:
+		return []byte("MPTCP"), nil
+	}
+	return nil, fmt.Errorf("invalid Steering Functionality: %d", ie)
+}
+
+// UnmarshalText sets value of data to *ie.
+func (ie *SteeringFunctionality) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "ATSSS-LL":
+		*ie = 0
+	case "MPTCP":
+		*ie = 1
+	default:
+		return fmt.Errorf("invalid Steering Functionality: %s", string(data))
+	}
+	return nil
+}
+
+// SteeringMode IE
+type SteeringMode byte
+
+// MarshalText returns text of ie
+func (ie SteeringMode) MarshalText() ([]byte, error) {
+	switch ie {
+	case 0:
+		return []byte("Active-Standby"), nil
+	case 1:
+		return []byte("Smallest Delay"), nil
+	case 2:
+		return []byte("Load Balancing"), nil
+	case 3:
+		return []byte("Priority-based"), nil
+	case 4:
+		return []byte("Redundant"), nil
+	}
+	return nil, fmt.Errorf("invalid Steering Mode: %d", ie)
+}
+
+// UnmarshalText sets value of data to *ie.
+func (ie *SteeringMode) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "Active-Standby":
+		*ie = 0
+	case "Smallest Delay":
+		*ie = 1
+	case "Load Balancing":
+		*ie = 2
+	case "Priority-based":
+		*ie = 3
+	case "Redundant":
+		*ie = 4
+	default:
+		return fmt.Errorf("invalid Steering Mode: %s", string(data))
+	}
+	return nil
+}
+
+// AccessPriority is Priority IE of access forwarding
+type AccessPriority byte
+
+// MarshalText returns text of ie
+func (ie AccessPriority) MarshalText() ([]byte, error) {
+	switch ie {
+	case 0:
+		return []byte("Active"), nil
+	case 1:
+		return []byte("Standby"), nil
+	case 2:
+		return []byte("No Standby"), nil
+	case 3:
+		return []byte("High"), nil
+	case 4:
+		return []byte("Low"), nil
+	}
+	return nil, fmt.Errorf("invalid Priority: %d", ie)
+}
+
+// UnmarshalText sets value of data to *ie.
+func (ie *AccessPriority) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "Active":
+		*ie = 0
+	case "Standby":
+		*ie = 1
+	case "No Standby":
+		*ie = 2
+	case "High":
+		*ie = 3
+	case "Low":
+		*ie = 4
+	default:
+		return fmt.Errorf("invalid Priority: %s", string(data))
+	}
+	return nil
+}
+
+// ProvideATSSS is Provide ATSSS Control Information IE
+type ProvideATSSS struct {
+	MPTCP   bool `json:"MPTCP,omitempty"`
+	ATSSSLL bool `json:"ATSSS-LL,omitempty"`
+	PMF     bool `json:"PMF,omitempty"`
+}
+
+func (ie ProvideATSSS) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(220))
+	buf := new(bytes.Buffer)
+
+	if ie.MPTCP {
+		buf.Write([]byte{0x00, 0xde, 0x00, 0x01, 0x01})
+	}
+	if ie.ATSSSLL {
+		buf.Write([]byte{0x00, 0xdf, 0x00, 0x01, 0x01})
+	}
+	if ie.PMF {
+		buf.Write([]byte{0x00, 0xe0, 0x00, 0x01, 0x01})
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// ATSSSControlParameters IE
+type ATSSSControlParameters struct {
+	MPTCP   *MPTCPParameters `json:"MPTCP,omitempty"`
+	ATSSSLL bool             `json:"ATSSS-LL,omitempty"`
+	PMF     *PMFParameters   `json:"PMF,omitempty"`
+}
+
+func (ie *ATSSSControlParameters) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 225:
+			ie.MPTCP = &MPTCPParameters{}
+			e = ie.MPTCP.decode(i.Data)
+		case 226:
+			var c []IE
+			if c, e = pfcp.DecodeIEs(i.Data); e != nil {
+				break
+			}
+			for _, j := range c {
+				if j.IEType == 231 && len(j.Data) != 0 {
+					ie.ATSSSLL = j.Data[0]&0x01 == 0x01
+				}
+			}
+		case 227:
+			ie.PMF = &PMFParameters{}
+			e = ie.PMF.decode(i.Data)
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+// MPTCPParameters IE
+type MPTCPParameters struct {
+	ProxyType   byte       `json:"proxyType"`
+	ProxyPort   uint16     `json:"proxyPort"`
+	ProxyIPv4   net.IP     `json:"proxyIPv4,omitempty"`
+	ProxyIPv6   net.IP     `json:"proxyIPv6,omitempty"`
+	UELinkAddrs *LinkAddrs `json:"UELinkSpecificAddress,omitempty"`
+}
+
+// LinkAddrs is UE Link-Specific IP Address IE
+type LinkAddrs struct {
+	IPv4For3GPP    net.IP `json:"3GPPIPv4,omitempty"`
+	IPv6For3GPP    net.IP `json:"3GPPIPv6,omitempty"`
+	IPv4ForNon3GPP net.IP `json:"non3GPPIPv4,omitempty"`
+	IPv6ForNon3GPP net.IP `json:"non3GPPIPv6,omitempty"`
+}
+
+func (ie *MPTCPParameters) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 228:
+			buf := bytes.NewReader(i.Data)
+			var flag byte
+			if flag, e = buf.ReadByte(); e != nil {
+				break
+			}
+			if ie.ProxyType, e = buf.ReadByte(); e != nil {
+				break
+			}
+			if e = binary.Read(buf, binary.BigEndian, &ie.ProxyPort); e != nil {
+				break
+			}
+			if flag&0x01 == 0x01 {
+				ie.ProxyIPv4 = make([]byte, 4)
+				if _, e = io.ReadFull(buf, ie.ProxyIPv4); e != nil {
+					break
+				}
+			}
+			if flag&0x02 == 0x02 {
+				ie.ProxyIPv6 = make([]byte, 16)
+				_, e = io.ReadFull(buf, ie.ProxyIPv6)
+			}
+		case 229:
+			ie.UELinkAddrs = &LinkAddrs{}
+			e = ie.UELinkAddrs.decode(i.Data)
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+func (ie *LinkAddrs) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	for i, a := range []*net.IP{
+		&ie.IPv4For3GPP, &ie.IPv6For3GPP, &ie.IPv4ForNon3GPP, &ie.IPv6ForNon3GPP} {
+		if flag&(0x01<<uint(i)) == 0 {
+			continue
+		}
+		*a = make([]byte, 4+12*(i%2))
+		if _, e = io.ReadFull(buf, *a); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// PMFParameters IE
+type PMFParameters struct {
+	IPv4           net.IP           `json:"IPv4,omitempty"`
+	IPv6           net.IP           `json:"IPv6,omitempty"`
+	PortFor3GPP    uint16           `json:"3GPPPort"`
+	PortForNon3GPP uint16           `json:"non3GPPPort"`
+	MACFor3GPP     net.HardwareAddr `json:"3GPPMAC,omitempty"`
+	MACForNon3GPP  net.HardwareAddr `json:"non3GPPMAC,omitempty"`
+}
+
+func (ie *PMFParameters) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		if i.IEType != 230 {
+			continue
+		}
+		buf := bytes.NewReader(i.Data)
+		var flag byte
+		if flag, e = buf.ReadByte(); e != nil {
+			return
+		}
+		if flag&0x01 == 0x01 {
+			ie.IPv4 = make([]byte, 4)
+			if _, e = io.ReadFull(buf, ie.IPv4); e != nil {
+				return
+			}
+		}
+		if flag&0x02 == 0x02 {
+			ie.IPv6 = make([]byte, 16)
+			if _, e = io.ReadFull(buf, ie.IPv6); e != nil {
+				return
+			}
+		}
+		if e = binary.Read(buf, binary.BigEndian, &ie.PortFor3GPP); e != nil {
+			return
+		}
+		if e = binary.Read(buf, binary.BigEndian, &ie.PortForNon3GPP); e != nil {
+			return
+		}
+		if flag&0x04 == 0x04 {
+			ie.MACFor3GPP = make([]byte, 6)
+			if _, e = io.ReadFull(buf, ie.MACFor3GPP); e != nil {
+				return
+			}
+			ie.MACForNon3GPP = make([]byte, 6)
+			if _, e = io.ReadFull(buf, ie.MACForNon3GPP); e != nil {
+				return
+			}
+		}
+	}
+	return
+}
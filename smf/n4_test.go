@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+func TestFSEIDRoundTrip(t *testing.T) {
+	for _, ie := range []FSEID{
+		{ID: 1, IPv4: net.ParseIP("10.0.0.1").To4()},
+		{ID: 2, IPv6: net.ParseIP("2001:db8::1")},
+		{ID: 0xfedcba9876543210, IPv4: net.ParseIP("10.0.0.1").To4(),
+			IPv6: net.ParseIP("2001:db8::1")},
+	} {
+		buf := new(bytes.Buffer)
+		ie.encode(buf)
+		b := buf.Bytes()
+		if binary.BigEndian.Uint16(b) != 57 ||
+			int(binary.BigEndian.Uint16(b[2:])) != len(b)-4 {
+			t.Fatalf("invalid IE header % x", b[:4])
+		}
+
+		v := FSEID{}
+		if e := v.decode(b[4:]); e != nil {
+			t.Fatalf("decode %+v failed: %s", ie, e)
+		}
+		if v.ID != ie.ID || !v.IPv4.Equal(ie.IPv4) || !v.IPv6.Equal(ie.IPv6) {
+			t.Errorf("decoded %+v, expected %+v", v, ie)
+		}
+	}
+}
+
+func TestFSEIDTruncated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	FSEID{ID: 1, IPv4: net.ParseIP("10.0.0.1").To4(),
+		IPv6: net.ParseIP("2001:db8::1")}.encode(buf)
+	b := buf.Bytes()
+
+	for _, l := range []int{len(b) - 1, len(b) - 16, 4 + 9 + 2} {
+		if e := new(FSEID).decode(b[4:l]); e == nil {
+			t.Errorf("no error for truncated F-SEID of %d octets", l-4)
+		}
+	}
+}
+
+// pfcpMessage returns PFCP message with header for the sequence number
+func pfcpMessage(typ byte, seid *uint64, sequence uint32, ies []byte) []byte {
+	buf := bytes.NewBuffer([]byte{0x20, typ, 0x00, 0x00})
+	if seid != nil {
+		buf.Bytes()[0] = 0x21
+		binary.Write(buf, binary.BigEndian, *seid)
+	}
+	binary.Write(buf, binary.BigEndian, sequence<<8)
+	buf.Write(ies)
+	b := buf.Bytes()
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-4))
+	return b
+}
+
+// fakeUPF answers PFCP requests on con, and sends CP F-SEID of
+// establishment requests to rx
+func fakeUPF(con *net.UDPConn, upSEID FSEID, rx chan<- FSEID) {
+	accept := []byte{0x00, 0x13, 0x00, 0x01, 0x01}
+	node := append([]byte{0x00, 0x3c, 0x00, 0x11, 0x01}, net.IPv6loopback...)
+	b := make([]byte, 65536)
+	for {
+		n, a, e := con.ReadFromUDP(b)
+		if e != nil {
+			return
+		}
+		m, e := pfcp.Parse(b[:n])
+		if e != nil {
+			continue
+		}
+		var res []byte
+		switch m.MessageType {
+		case 5, 9:
+			res = pfcpMessage(m.MessageType+1, nil, m.Sequence,
+				append(append([]byte{}, node...), accept...))
+		case 50:
+			var cp FSEID
+			for _, ie := range m.IEs {
+				if ie.IEType == 57 {
+					cp.decode(ie.Data)
+				}
+			}
+			rx <- cp
+			buf := bytes.NewBuffer(append([]byte{}, node...))
+			buf.Write(accept)
+			upSEID.encode(buf)
+			res = pfcpMessage(51, &cp.ID, m.Sequence, buf.Bytes())
+		case 54:
+			res = pfcpMessage(55, &m.SessionID, m.Sequence, accept)
+		default:
+			continue
+		}
+		con.WriteToUDP(res, a)
+	}
+}
+
+func TestIPv6EstablishmentOnLoopback(t *testing.T) {
+	ln, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6loopback})
+	if e != nil {
+		t.Skip("IPv6 loopback is not available:", e)
+	}
+	defer ln.Close()
+
+	up := FSEID{ID: 0x1234,
+		IPv4: net.ParseIP("127.0.0.1").To4(), IPv6: net.IPv6loopback}
+	rx := make(chan FSEID, 1)
+	go fakeUPF(ln, up, rx)
+
+	dualStack = net.ParseIP("127.0.0.1")
+	defer func() { dualStack = nil }()
+	if e = dialPFCP("[::1]:0", ln.LocalAddr().String()); e != nil {
+		t.Fatalf("association setup failed: %s", e)
+	}
+	defer closePFCP()
+	if peerNode != "::1" {
+		t.Errorf("peer node is %s, expected ::1", peerNode)
+	}
+
+	_, res, e := establishSession(EstablishmentRequest{
+		PDR: []CreatePDR{{ID: 1, FAR: 1}},
+		FAR: []CreateFAR{{ID: 1}}})
+	if e != nil {
+		t.Fatalf("session establishment failed: %s", e)
+	}
+
+	cp := <-rx
+	if !cp.IPv6.Equal(net.IPv6loopback) || !cp.IPv4.Equal(dualStack) {
+		t.Errorf("CP F-SEID is %+v, expected ::1 and %s", cp, dualStack)
+	}
+	if res.UPFSEID == nil || res.UPFSEID.ID != up.ID ||
+		!res.UPFSEID.IPv4.Equal(up.IPv4) || !res.UPFSEID.IPv6.Equal(up.IPv6) {
+		t.Errorf("UP F-SEID is %+v, expected %+v", res.UPFSEID, up)
+	}
+}
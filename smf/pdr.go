@@ -20,7 +20,7 @@ type CreatePDR struct {
 	// Activate Predefined Rules
 	// Activation Time
 	// Deactivation Time
-	// MAR
+	MAR uint16 `json:"MAR,omitempty"`
 	// Packet Replication and Detection Carry-On Information
 	// IP Multicast Addressing Info
 	// UE IP address Pool Identity
@@ -52,6 +52,10 @@ func (ie CreatePDR) encode(b *bytes.Buffer) {
 		buf.Write([]byte{0x00, 0x6d, 0x00, 0x04})
 		binary.Write(buf, binary.BigEndian, qer)
 	}
+	if ie.MAR != 0 {
+		buf.Write([]byte{0x00, 0xaa, 0x00, 0x02})
+		binary.Write(buf, binary.BigEndian, ie.MAR)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -123,8 +127,9 @@ func (ie RemovePDR) encode(b *bytes.Buffer) {
 type CreatedPDR struct {
 	ID    uint16 `json:"ID"`
 	FTEID *FTEID `json:"FTEID,omitempty"`
-	// Local F-TEID for Redundant Transmission
-	UEIP *UEIP `json:"UE_IP,omitempty"`
+	// RedundantFTEID is Local F-TEID for Redundant Transmission
+	RedundantFTEID *FTEID `json:"redundantFTEID,omitempty"`
+	UEIP           *UEIP  `json:"UE_IP,omitempty"`
 }
 
 func (ie *CreatedPDR) decode(b []byte) (e error) {
@@ -157,8 +162,13 @@ func (ie *CreatedPDR) decode(b []byte) (e error) {
 				ie.ID = (ie.ID << 8) | uint16(b[1])
 			}
 		case 21:
-			ie.FTEID = &FTEID{}
-			e = ie.FTEID.decode(b)
+			if ie.FTEID == nil {
+				ie.FTEID = &FTEID{}
+				e = ie.FTEID.decode(b)
+			} else {
+				ie.RedundantFTEID = &FTEID{}
+				e = ie.RedundantFTEID.decode(b)
+			}
 		case 93:
 			ie.UEIP = &UEIP{}
 			e = ie.UEIP.decode(b)
@@ -174,7 +184,8 @@ func (ie *CreatedPDR) decode(b []byte) (e error) {
 // UpdatedPDR IE
 type UpdatedPDR struct {
 	ID uint16 `json:"ID"`
-	// Local F-TEID for Redundant Transmission
+	// RedundantFTEID is Local F-TEID for Redundant Transmission
+	RedundantFTEID *FTEID `json:"redundantFTEID,omitempty"`
 }
 
 func (ie *UpdatedPDR) decode(b []byte) (e error) {
@@ -206,6 +217,9 @@ func (ie *UpdatedPDR) decode(b []byte) (e error) {
 				ie.ID = uint16(b[0])
 				ie.ID = (ie.ID << 8) | uint16(b[1])
 			}
+		case 21:
+			ie.RedundantFTEID = &FTEID{}
+			e = ie.RedundantFTEID.decode(b)
 		}
 		if e != nil {
 			break
@@ -217,14 +231,14 @@ func (ie *UpdatedPDR) decode(b []byte) (e error) {
 
 // PDI IE
 type PDI struct {
-	Interface Interface `json:"interface"`
-	FTEID     *FTEID    `json:"FTEID,omitempty"`
-	Instance  string    `json:"instance,omitempty"`
-	//Redundant Transmission Parameters
-	UEIP *UEIP `json:"UE_IP,omitempty"`
+	Interface Interface              `json:"interface"`
+	FTEID     *FTEID                 `json:"FTEID,omitempty"`
+	Instance  string                 `json:"instance,omitempty"`
+	Redundant *RedundantTransmission `json:"redundant,omitempty"`
+	UEIP      *UEIP                  `json:"UE_IP,omitempty"`
 	//Traffic Endpoint ID
 	//SDF Filter
-	//Application ID
+	ApplicationID string `json:"applicationID,omitempty"`
 	//Ethernet PDU Session Information
 	//Ethernet Packet Filter
 	QFI byte `json:"QFI,omitempty"`
@@ -248,9 +262,17 @@ func (p PDI) encode(b *bytes.Buffer) {
 			byte(len(p.Instance) >> 8), byte(len(p.Instance))})
 		buf.WriteString(p.Instance)
 	}
+	if p.Redundant != nil {
+		p.Redundant.encode(buf)
+	}
 	if p.UEIP != nil {
 		p.UEIP.encode(buf)
 	}
+	if len(p.ApplicationID) != 0 {
+		buf.Write([]byte{0x00, 0x18,
+			byte(len(p.ApplicationID) >> 8), byte(len(p.ApplicationID))})
+		buf.WriteString(p.ApplicationID)
+	}
 	if p.QFI != 0 {
 		buf.Write([]byte{0x00, 0x7c, 0x00, 0x01, p.QFI})
 	}
@@ -259,6 +281,27 @@ func (p PDI) encode(b *bytes.Buffer) {
 	buf.WriteTo(b)
 }
 
+// RedundantTransmission is Redundant Transmission Parameters IE in PDI
+type RedundantTransmission struct {
+	FTEID    FTEID  `json:"FTEID"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func (ie RedundantTransmission) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(255))
+	buf := new(bytes.Buffer)
+
+	ie.FTEID.encode(buf)
+	if len(ie.Instance) != 0 {
+		buf.Write([]byte{0x00, 0x16,
+			byte(len(ie.Instance) >> 8), byte(len(ie.Instance))})
+		buf.WriteString(ie.Instance)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
 // HeaderRemoval IE
 type HeaderRemoval struct {
 	Desctiption int  `json:"description"`
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/fkgi/harico/gtpu"
+)
+
+var (
+	gnbs     []gtpu.Handler // built-in gNB
+	gnbAddrs []*net.UDPAddr
+	pdus     = make(map[uint64]*PDUSession) // guarded by tunLock
+
+	handoverLock sync.Mutex // serializes handovers
+)
+
+// PDUSessionRequest data
+type PDUSessionRequest struct {
+	Session EstablishmentRequest `json:"session"`
+	Device  string               `json:"device"`
+	// UplinkPDR is the PDR which has N3 F-TEID of UPF,
+	// the first created F-TEID is used if it is 0
+	UplinkPDR uint16 `json:"uplinkPDR,omitempty"`
+	// DownlinkFAR is updated to forward packets to the gNB
+	DownlinkFAR uint32 `json:"downlinkFAR"`
+	FlowID      *byte  `json:"flowID,omitempty"`
+	GNB         int    `json:"gNB,omitempty"`
+}
+
+// PDUSession context
+type PDUSession struct {
+	ID          string       `json:"ID"`
+	Device      string       `json:"device"`
+	DownlinkFAR uint32       `json:"downlinkFAR"`
+	FlowID      *byte        `json:"flowID,omitempty"`
+	GNB         int          `json:"gNB"`
+	UPF         FTEID        `json:"UPF"`
+	AN          FTEID        `json:"AN"`
+	PDR         []CreatedPDR `json:"PDR,omitempty"`
+}
+
+// HandoverRequest data
+type HandoverRequest struct {
+	GNB       int  `json:"gNB"`
+	EndMarker bool `json:"endMarker,omitempty"`
+}
+
+func startGNB(addrs []string) error {
+	for _, a := range addrs {
+		la, e := net.ResolveUDPAddr("udp", a)
+		if e != nil {
+			return e
+		}
+		h, e := gtpu.StartHandler(a)
+		if e != nil {
+			return e
+		}
+		gnbs = append(gnbs, h)
+		gnbAddrs = append(gnbAddrs, la)
+	}
+	return nil
+}
+
+func closeGNB() {
+	for i := range gnbs {
+		gnbs[i].Close()
+	}
+}
+
+func handlePDUSessionPOST(w http.ResponseWriter, r *http.Request) {
+	confLock.RLock()
+	d := PDUSessionRequest{
+		Device: pduConf.Device,
+		FlowID: pduConf.FlowID}
+	confLock.RUnlock()
+	var e error
+	if d.Session, e = sessionTemplate(r); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid template",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	var ps []InvalidParam
+	if needValidation(r) {
+		ps = d.Session.validate()
+		for i := range ps {
+			ps[i].Param = "/session" + ps[i].Param
+		}
+	}
+	if d.GNB < 0 || d.GNB >= len(gnbs) {
+		ps = append(ps, InvalidParam{
+			Param:  "/gNB",
+			Reason: fmt.Sprintf("gNB %d is not available", d.GNB)})
+	}
+	if len(d.Device) == 0 {
+		ps = append(ps, InvalidParam{
+			Param:  "/device",
+			Reason: "tun device is required"})
+	}
+	if len(ps) != 0 {
+		errorResponse(w, ProblemDetails{
+			Title:         "invalid request",
+			Status:        http.StatusBadRequest,
+			Detail:        "PDU session request has invalid parameters",
+			Instance:      r.URL.Path,
+			InvalidParams: ps})
+		return
+	}
+
+	lid, res, e := establishSession(d.Session)
+	if ce, ok := e.(*causeError); ok {
+		p := ce.problem(r.URL.Path, d.Session.rulePath)
+		for i := range p.InvalidParams {
+			p.InvalidParams[i].Param = "/session" + p.InvalidParams[i].Param
+		}
+		errorResponse(w, p)
+		return
+	} else if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	c := &PDUSession{
+		ID:          res.ContextID,
+		Device:      d.Device,
+		DownlinkFAR: d.DownlinkFAR,
+		FlowID:      d.FlowID,
+		GNB:         d.GNB,
+		PDR:         res.PDR}
+	if f := d.uplinkFTEID(res); f != nil {
+		c.UPF = *f
+	} else {
+		e = fmt.Errorf("no F-TEID of UPF")
+	}
+	if e == nil {
+		e = c.bind()
+	}
+	if e == nil {
+		e = c.forward(false)
+	}
+	if e != nil {
+		log.Println("PDU session setup failed:", e)
+		if c.AN.ID != 0 {
+			gnbs[c.GNB].Unbind(c.AN.ID)
+		}
+		t, _ := lookupSession(lid)
+		deleteSession(t, lid)
+		errorResponse(w, ProblemDetails{
+			Title:    "PDU session setup failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	b, _ = json.Marshal(c)
+	tunLock.Lock()
+	pdus[lid] = c
+	tunLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/pfcp-cp/v1/pdu-session/"+c.ID)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+func (d PDUSessionRequest) uplinkFTEID(res EstablishmentResponse) *FTEID {
+	for _, p := range res.PDR {
+		if p.FTEID != nil && (d.UplinkPDR == 0 || d.UplinkPDR == p.ID) {
+			return p.FTEID
+		}
+	}
+	for _, p := range d.Session.PDR {
+		if p.PDI.FTEID != nil && p.PDI.FTEID.ID != 0 &&
+			(d.UplinkPDR == 0 || d.UplinkPDR == p.ID) {
+			return p.PDI.FTEID
+		}
+	}
+	return nil
+}
+
+// bind GTP-U tunnel of the gNB to the UPF
+func (c *PDUSession) bind() (e error) {
+	var ip net.IP
+	if c.UPF.IPv4 != nil {
+		ip = c.UPF.IPv4
+	} else {
+		ip = c.UPF.IPv6
+	}
+	h := &gnbs[c.GNB]
+	c.AN = FTEID{}
+	c.AN.ID, e = h.Bind(c.UPF.ID,
+		net.JoinHostPort(ip.String(), "2152"), c.Device)
+	if e != nil {
+		return
+	}
+	if ip4 := gnbAddrs[c.GNB].IP.To4(); ip4 != nil {
+		c.AN.IPv4 = ip4
+	} else {
+		c.AN.IPv6 = gnbAddrs[c.GNB].IP
+	}
+	if c.FlowID != nil {
+		e = h.SetFlowIDto(c.AN.ID, *c.FlowID)
+	}
+	return
+}
+
+// forward updates the downlink FAR to the gNB tunnel
+func (c *PDUSession) forward(endMarker bool) error {
+	id, _ := strconv.ParseUint(c.ID, 16, 64)
+	t, ok := lookupSession(id)
+	if !ok {
+		return fmt.Errorf("no such session")
+	}
+	f := UpdateFAR{
+		ID:     c.DownlinkFAR,
+		Action: &Action{FORW: true},
+		Forwarding: &UpdateForwardingParameter{
+			Header: &HeaderCreation{
+				ID:   c.AN.ID,
+				IPv4: c.AN.IPv4,
+				IPv6: c.AN.IPv6}}}
+	if endMarker {
+		f.Forwarding.Flags = &PFCPSMReqFlags{SNDEM: true}
+	}
+	_, e := modifySession(t, id, ModificationRequest{UpdateFAR: []UpdateFAR{f}})
+	return e
+}
+
+func handlePDUSessionLIST(w http.ResponseWriter, r *http.Request) {
+	tunLock.RLock()
+	res := make([]string, 0, len(pdus))
+	for _, c := range pdus {
+		res = append(res, c.ID)
+	}
+	tunLock.RUnlock()
+
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handlePDUSessionGET(w http.ResponseWriter, r *http.Request, c *PDUSession) {
+	tunLock.RLock()
+	b, _ := json.Marshal(c)
+	tunLock.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handlePDUSessionDELETE(w http.ResponseWriter, r *http.Request, c *PDUSession, id uint64) {
+	tunLock.Lock()
+	releasePDU(id)
+	tunLock.Unlock()
+
+	if t, ok := lookupSession(id); ok {
+		_, e := deleteSession(t, id)
+		if ce, ok := e.(*causeError); ok {
+			errorResponse(w, ce.problem(r.URL.Path, nil))
+			return
+		} else if e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "PFCP message handling failed",
+				Status:   http.StatusInternalServerError,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleHandoverPOST(w http.ResponseWriter, r *http.Request, c *PDUSession) {
+	d := HandoverRequest{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if d.GNB < 0 || d.GNB >= len(gnbs) {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   "handover request has invalid parameters",
+			Instance: r.URL.Path,
+			InvalidParams: []InvalidParam{{
+				Param:  "/gNB",
+				Reason: fmt.Sprintf("gNB %d is not available", d.GNB)}}})
+		return
+	}
+
+	// target gNB is bound and the FAR is updated on copy of the context,
+	// then the context is replaced and source gNB is released
+	handoverLock.Lock()
+	defer handoverLock.Unlock()
+	tunLock.RLock()
+	n := *c
+	tunLock.RUnlock()
+	n.GNB = d.GNB
+	if e = n.bind(); e == nil {
+		e = n.forward(d.EndMarker)
+	}
+
+	var old PDUSession
+	if e == nil {
+		tunLock.Lock()
+		id, _ := strconv.ParseUint(c.ID, 16, 64)
+		if cur, ok := pdus[id]; ok && cur == c {
+			// ID may be changed by session report
+			old, n.ID = *c, c.ID
+			*c = n
+			b, _ = json.Marshal(c)
+		} else {
+			e = fmt.Errorf("PDU session is released")
+		}
+		tunLock.Unlock()
+	}
+	if e != nil {
+		if n.AN.ID != 0 {
+			gnbs[n.GNB].Unbind(n.AN.ID)
+		}
+		log.Println("handover failed:", e)
+		errorResponse(w, ProblemDetails{
+			Title:    "handover failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = gnbs[old.GNB].Unbind(old.AN.ID); e != nil {
+		log.Println("GTP-U tunnel unbinding failed:", e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// lookupPDU returns the PDU session of the local SEID
+func lookupPDU(id uint64) (*PDUSession, bool) {
+	tunLock.RLock()
+	defer tunLock.RUnlock()
+	c, ok := pdus[id]
+	return c, ok
+}
+
+// releasePDU unbinds GTP-U tunnel of the PDU session if it exists.
+// tunLock must be held by the caller.
+func releasePDU(id uint64) {
+	c, ok := pdus[id]
+	if !ok {
+		return
+	}
+	if e := gnbs[c.GNB].Unbind(c.AN.ID); e != nil {
+		log.Println("GTP-U tunnel unbinding failed:", e)
+	}
+	delete(pdus, id)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// PFDs provisioned to the UPF, key is Application ID
+var pfds = make(map[string]ApplicationPFDs)
+
+// ApplicationPFDs is Application ID's PFDs IE
+type ApplicationPFDs struct {
+	ApplicationID string       `json:"applicationID"`
+	PFDContext    []PFDContext `json:"PFDContext,omitempty"`
+}
+
+// PFDContext IE
+type PFDContext struct {
+	Contents []PFDContents `json:"contents"`
+}
+
+// PFDContents IE
+type PFDContents struct {
+	FlowDescription    string   `json:"flowDescription,omitempty"`
+	URL                string   `json:"URL,omitempty"`
+	DomainName         string   `json:"domainName,omitempty"`
+	CustomPFD          string   `json:"customPFD,omitempty"`
+	DomainNameProtocol string   `json:"domainNameProtocol,omitempty"`
+	AdditionalFlows    []string `json:"additionalFlowDescriptions,omitempty"`
+	AdditionalURLs     []string `json:"additionalURLs,omitempty"`
+	AdditionalProtocol []string `json:"additionalDomainNameProtocols,omitempty"`
+}
+
+func (ie ApplicationPFDs) encode(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x3a})
+	buf := new(bytes.Buffer)
+
+	buf.Write([]byte{0x00, 0x18,
+		byte(len(ie.ApplicationID) >> 8), byte(len(ie.ApplicationID))})
+	buf.WriteString(ie.ApplicationID)
+	for _, c := range ie.PFDContext {
+		c.encode(buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (ie PFDContext) encode(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x3b})
+	buf := new(bytes.Buffer)
+
+	for _, c := range ie.Contents {
+		c.encode(buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (ie PFDContents) encode(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x3d})
+	buf := new(bytes.Buffer)
+
+	var flag byte
+	for i, v := range []string{ie.FlowDescription, ie.URL, ie.DomainName,
+		ie.CustomPFD, ie.DomainNameProtocol} {
+		if len(v) != 0 {
+			flag |= 0x01 << uint(i)
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+			buf.WriteString(v)
+		}
+	}
+	for i, vs := range [][]string{
+		ie.AdditionalFlows, ie.AdditionalURLs, ie.AdditionalProtocol} {
+		if len(vs) == 0 {
+			continue
+		}
+		flag |= 0x20 << uint(i)
+		l := 0
+		for _, v := range vs {
+			l += 2 + len(v)
+		}
+		binary.Write(buf, binary.BigEndian, uint16(l))
+		for _, v := range vs {
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+			buf.WriteString(v)
+		}
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()+2))
+	b.Write([]byte{flag, 0x00})
+	buf.WriteTo(b)
+}
+
+func (ie *PFDContents) decode(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("too short data")
+	}
+	flag := b[0]
+	b = b[2:]
+	next := func() (string, error) {
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			return "", fmt.Errorf("too short data")
+		}
+		l := int(binary.BigEndian.Uint16(b))
+		v := string(b[2 : 2+l])
+		b = b[2+l:]
+		return v, nil
+	}
+
+	for i, v := range []*string{&ie.FlowDescription, &ie.URL, &ie.DomainName,
+		&ie.CustomPFD, &ie.DomainNameProtocol} {
+		if flag&(0x01<<uint(i)) == 0 {
+			continue
+		}
+		var e error
+		if *v, e = next(); e != nil {
+			return e
+		}
+	}
+	for i, vs := range []*[]string{
+		&ie.AdditionalFlows, &ie.AdditionalURLs, &ie.AdditionalProtocol} {
+		if flag&(0x20<<uint(i)) == 0 {
+			continue
+		}
+		g, e := next()
+		if e != nil {
+			return e
+		}
+		for d := []byte(g); len(d) != 0; {
+			if len(d) < 2 || len(d) < 2+int(binary.BigEndian.Uint16(d)) {
+				return fmt.Errorf("too short data")
+			}
+			l := int(binary.BigEndian.Uint16(d))
+			*vs = append(*vs, string(d[2:2+l]))
+			d = d[2+l:]
+		}
+	}
+	return nil
+}
+
+func handlePFDPUT(w http.ResponseWriter, r *http.Request) {
+	var d []ApplicationPFDs
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if needValidation(r) {
+		var ps []InvalidParam
+		for i, a := range d {
+			ps = append(ps, a.validate(fmt.Sprintf("/%d", i))...)
+		}
+		if len(ps) != 0 {
+			errorResponse(w, ProblemDetails{
+				Title:         "invalid request",
+				Status:        http.StatusBadRequest,
+				Detail:        "PFD management request has invalid parameters",
+				Instance:      r.URL.Path,
+				InvalidParams: ps})
+			return
+		}
+	}
+
+	if e = managePFD(d); e != nil {
+		pfdError(w, r, e)
+		return
+	}
+	for _, a := range d {
+		if len(a.PFDContext) == 0 {
+			delete(pfds, a.ApplicationID)
+		} else {
+			pfds[a.ApplicationID] = a
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handlePFDGET(w http.ResponseWriter, r *http.Request) {
+	l := make([]ApplicationPFDs, 0, len(pfds))
+	for _, a := range pfds {
+		l = append(l, a)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].ApplicationID < l[j].ApplicationID
+	})
+
+	b, _ := json.Marshal(l)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// handlePFDDELETE removes all PFDs which are provisioned to the UPF
+func handlePFDDELETE(w http.ResponseWriter, r *http.Request) {
+	d := make([]ApplicationPFDs, 0, len(pfds))
+	for id := range pfds {
+		d = append(d, ApplicationPFDs{ApplicationID: id})
+	}
+
+	if len(d) != 0 {
+		if e := managePFD(d); e != nil {
+			pfdError(w, r, e)
+			return
+		}
+	}
+	pfds = make(map[string]ApplicationPFDs)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// managePFD sends PFD Management Request. Application ID without
+// PFD context removes all PFDs of the application.
+func managePFD(d []ApplicationPFDs) error {
+	buf := bytes.NewBuffer([]byte{
+		0x20, 0x03,
+		0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00})
+	for _, a := range d {
+		a.encode(buf)
+	}
+	nodeID(buf)
+
+	m, e := writeMessage(buf.Bytes())
+	if e != nil {
+		return e
+	}
+	for _, ie := range m.IEs {
+		if ie.IEType == 19 && decodeCause(ie.Data) != 1 {
+			ce := &causeError{}
+			ce.decode(m.IEs)
+			return ce
+		}
+	}
+	return nil
+}
+
+func pfdError(w http.ResponseWriter, r *http.Request, e error) {
+	if ce, ok := e.(*causeError); ok {
+		errorResponse(w, ce.problem(r.URL.Path, nil))
+		return
+	}
+	errorResponse(w, ProblemDetails{
+		Title:    "PFD management failed",
+		Status:   http.StatusInternalServerError,
+		Detail:   e.Error(),
+		Instance: r.URL.Path})
+}
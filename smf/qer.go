@@ -3,21 +3,26 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
 )
 
 // CreateQER IE
 type CreateQER struct {
-	ID          uint32     `json:"ID"`
-	Correlation uint32     `json:"correlationID,omitempty"`
-	GateStatus  GateStatus `json:"gateStatus"`
-	MBR         *bitrate   `json:"MBR,omitempty"`
-	GBR         *bitrate   `json:"GBR,omitempty"`
-	// Packet Rate Status
-	QFI byte `json:"QFI,omitempty"`
-	RQI bool `json:"RQI,omitempty"`
-	PPI byte `json:"PPI,omitempty"`
-	// Averaging Window
-	// QER Control Indications
+	ID          uint32      `json:"ID"`
+	Correlation uint32      `json:"correlationID,omitempty"`
+	GateStatus  GateStatus  `json:"gateStatus"`
+	MBR         *bitrate    `json:"MBR,omitempty"`
+	GBR         *bitrate    `json:"GBR,omitempty"`
+	PacketRate  *PacketRate `json:"packetRate,omitempty"`
+	// DL Flow Level Marking
+	QFI              byte                   `json:"QFI,omitempty"`
+	RQI              bool                   `json:"RQI,omitempty"`
+	PPI              byte                   `json:"PPI,omitempty"`
+	AveragingWindow  uint32                 `json:"averagingWindow,omitempty"`
+	PacketRateStatus *PacketRateStatus      `json:"packetRateStatus,omitempty"`
+	Indications      *QERControlIndications `json:"controlIndications,omitempty"`
 }
 
 func (ie CreateQER) encode(b *bytes.Buffer) {
@@ -40,6 +45,9 @@ func (ie CreateQER) encode(b *bytes.Buffer) {
 		buf.Write(ie.GBR.ulBytes())
 		buf.Write(ie.GBR.dlBytes())
 	}
+	if ie.PacketRate != nil {
+		ie.PacketRate.encode(buf)
+	}
 	if ie.QFI != 0 {
 		buf.Write([]byte{0x00, 0x7c, 0x00, 0x01, ie.QFI})
 	}
@@ -49,6 +57,16 @@ func (ie CreateQER) encode(b *bytes.Buffer) {
 	if ie.PPI != 0 {
 		buf.Write([]byte{0x00, 0x9e, 0x00, 0x01, ie.PPI})
 	}
+	if ie.AveragingWindow != 0 {
+		buf.Write([]byte{0x00, 0x9d, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.AveragingWindow)
+	}
+	if ie.PacketRateStatus != nil {
+		ie.PacketRateStatus.encode(buf)
+	}
+	if ie.Indications != nil {
+		ie.Indications.encode(buf)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -61,11 +79,13 @@ type UpdateQER struct {
 	GateStatus  *GateStatus `json:"gateStatus,omitempty"`
 	MBR         *bitrate    `json:"MBR,omitempty"`
 	GBR         *bitrate    `json:"GBR,omitempty"`
-	QFI         byte        `json:"QFI,omitempty"`
-	RQI         bool        `json:"RQI,omitempty"`
-	PPI         byte        `json:"PPI,omitempty"`
-	// Averaging Window
-	// QER Control Indications
+	PacketRate  *PacketRate `json:"packetRate,omitempty"`
+	// DL Flow Level Marking
+	QFI             byte                   `json:"QFI,omitempty"`
+	RQI             bool                   `json:"RQI,omitempty"`
+	PPI             byte                   `json:"PPI,omitempty"`
+	AveragingWindow uint32                 `json:"averagingWindow,omitempty"`
+	Indications     *QERControlIndications `json:"controlIndications,omitempty"`
 }
 
 func (ie UpdateQER) encode(b *bytes.Buffer) {
@@ -90,6 +110,9 @@ func (ie UpdateQER) encode(b *bytes.Buffer) {
 		binary.Write(buf, binary.BigEndian, ie.GBR.UL)
 		binary.Write(buf, binary.BigEndian, ie.GBR.DL)
 	}
+	if ie.PacketRate != nil {
+		ie.PacketRate.encode(buf)
+	}
 	if ie.QFI != 0 {
 		buf.Write([]byte{0x00, 0x7c, 0x00, 0x01, ie.QFI})
 	}
@@ -99,6 +122,13 @@ func (ie UpdateQER) encode(b *bytes.Buffer) {
 	if ie.PPI != 0 {
 		buf.Write([]byte{0x00, 0x9e, 0x00, 0x01, ie.PPI})
 	}
+	if ie.AveragingWindow != 0 {
+		buf.Write([]byte{0x00, 0x9d, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.AveragingWindow)
+	}
+	if ie.Indications != nil {
+		ie.Indications.encode(buf)
+	}
 
 	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
 	buf.WriteTo(b)
@@ -159,3 +189,252 @@ func (ie GateStatus) encode(b *bytes.Buffer) {
 	}
 	b.Write([]byte{0x00, 0x19, 0x00, 0x01, g})
 }
+
+// PacketRate IE
+type PacketRate struct {
+	UL           *RateLimit `json:"ul,omitempty"`
+	DL           *RateLimit `json:"dl,omitempty"`
+	AdditionalUL *RateLimit `json:"additionalUl,omitempty"`
+	AdditionalDL *RateLimit `json:"additionalDl,omitempty"`
+}
+
+func (ie PacketRate) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer([]byte{0x00, 0x5e, 0x00, 0x00, 0x00})
+
+	var flag byte = 0x00
+	if ie.UL != nil {
+		flag = flag | 0x01
+		ie.UL.encode(buf)
+	}
+	if ie.DL != nil {
+		flag = flag | 0x02
+		ie.DL.encode(buf)
+	}
+	if ie.AdditionalUL != nil || ie.AdditionalDL != nil {
+		flag = flag | 0x04
+		if ie.UL != nil {
+			if ie.AdditionalUL != nil {
+				ie.AdditionalUL.encode(buf)
+			} else {
+				ie.UL.encode(buf)
+			}
+		}
+		if ie.DL != nil {
+			if ie.AdditionalDL != nil {
+				ie.AdditionalDL.encode(buf)
+			} else {
+				ie.DL.encode(buf)
+			}
+		}
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	data[4] = flag
+	b.Write(data)
+}
+
+// RateLimit is maximum packet rate per time unit
+type RateLimit struct {
+	Unit TimeUnit `json:"unit"`
+	Max  uint16   `json:"max"`
+}
+
+func (ie RateLimit) encode(b *bytes.Buffer) {
+	b.WriteByte(byte(ie.Unit) & 0x07)
+	binary.Write(b, binary.BigEndian, ie.Max)
+}
+
+// TimeUnit of packet rate
+type TimeUnit byte
+
+// MarshalText returns text of ie
+func (ie TimeUnit) MarshalText() ([]byte, error) {
+	switch ie {
+	case 0:
+		return []byte("minute"), nil
+	case 1:
+		return []byte("6minutes"), nil
+	case 2:
+		return []byte("hour"), nil
+	case 3:
+		return []byte("day"), nil
+	case 4:
+		return []byte("week"), nil
+	}
+	return nil, fmt.Errorf("invalid Time Unit: %d", ie)
+}
+
+// UnmarshalText sets value of data to *ie.
+func (ie *TimeUnit) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "minute":
+		*ie = 0
+	case "6minutes":
+		*ie = 1
+	case "hour":
+		*ie = 2
+	case "day":
+		*ie = 3
+	case "week":
+		*ie = 4
+	default:
+		return fmt.Errorf("invalid Time Unit: %s", string(data))
+	}
+	return nil
+}
+
+// PacketRateStatus IE
+type PacketRateStatus struct {
+	UL           *uint16    `json:"ul,omitempty"`
+	DL           *uint16    `json:"dl,omitempty"`
+	AdditionalUL *uint16    `json:"additionalUl,omitempty"`
+	AdditionalDL *uint16    `json:"additionalDl,omitempty"`
+	Validity     *time.Time `json:"validityTime,omitempty"`
+}
+
+func (ie PacketRateStatus) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer([]byte{0x00, 0xc1, 0x00, 0x00, 0x00})
+
+	var flag byte = 0x00
+	if ie.UL != nil {
+		flag = flag | 0x01
+		binary.Write(buf, binary.BigEndian, *ie.UL)
+	}
+	if ie.DL != nil {
+		flag = flag | 0x02
+		binary.Write(buf, binary.BigEndian, *ie.DL)
+	}
+	if ie.AdditionalUL != nil || ie.AdditionalDL != nil {
+		flag = flag | 0x04
+		if ie.UL != nil {
+			var n uint16
+			if ie.AdditionalUL != nil {
+				n = *ie.AdditionalUL
+			}
+			binary.Write(buf, binary.BigEndian, n)
+		}
+		if ie.DL != nil {
+			var n uint16
+			if ie.AdditionalDL != nil {
+				n = *ie.AdditionalDL
+			}
+			binary.Write(buf, binary.BigEndian, n)
+		}
+	}
+	if ie.UL != nil || ie.DL != nil {
+		var t time.Time
+		if ie.Validity != nil {
+			t = *ie.Validity
+		}
+		encodeNTPTime(t, buf)
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	data[4] = flag
+	b.Write(data)
+}
+
+func (ie *PacketRateStatus) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	if flag&0x01 == 0x01 {
+		ie.UL = new(uint16)
+		if e = binary.Read(buf, binary.BigEndian, ie.UL); e != nil {
+			return
+		}
+	}
+	if flag&0x02 == 0x02 {
+		ie.DL = new(uint16)
+		if e = binary.Read(buf, binary.BigEndian, ie.DL); e != nil {
+			return
+		}
+	}
+	if flag&0x04 == 0x04 {
+		if flag&0x01 == 0x01 {
+			ie.AdditionalUL = new(uint16)
+			if e = binary.Read(buf, binary.BigEndian, ie.AdditionalUL); e != nil {
+				return
+			}
+		}
+		if flag&0x02 == 0x02 {
+			ie.AdditionalDL = new(uint16)
+			if e = binary.Read(buf, binary.BigEndian, ie.AdditionalDL); e != nil {
+				return
+			}
+		}
+	}
+	if buf.Len() >= 8 {
+		d := make([]byte, 8)
+		buf.Read(d)
+		ie.Validity = decodeNTPTime(d)
+	}
+	return
+}
+
+// QERControlIndications IE
+type QERControlIndications struct {
+	RCSR bool `json:"RCSR,omitempty"`
+}
+
+func (ie QERControlIndications) encode(b *bytes.Buffer) {
+	var f byte = 0x00
+	if ie.RCSR {
+		f = f | 0x01
+	}
+	b.Write([]byte{0x00, 0xfb, 0x00, 0x01, f})
+}
+
+// PacketRateStatusReport IE
+type PacketRateStatusReport struct {
+	ID     uint32           `json:"ID"`
+	Status PacketRateStatus `json:"packetRateStatus"`
+}
+
+func (ie *PacketRateStatusReport) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 109:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.ID = binary.BigEndian.Uint32(b)
+			}
+		case 193:
+			e = ie.Status.decode(b)
+		}
+		if e != nil {
+			break
+		}
+	}
+
+	return
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// RawMessage data
+type RawMessage struct {
+	// Hex is whole PFCP message, other parameters are ignored
+	// except Sequence and SEID if these are specified.
+	// SEID is overridden only in the message which has SEID.
+	Hex string `json:"hex,omitempty"`
+
+	MessageType byte    `json:"messageType,omitempty"`
+	SEID        string  `json:"SEID,omitempty"`
+	Sequence    *uint32 `json:"sequence,omitempty"`
+	Length      *uint16 `json:"length,omitempty"`
+	IEs         []RawIE `json:"IEs,omitempty"`
+}
+
+// RawIE data
+type RawIE struct {
+	Type   uint16  `json:"type"`
+	Name   string  `json:"name,omitempty"`
+	Length *uint16 `json:"length,omitempty"`
+	Data   string  `json:"data"`
+}
+
+func (d RawMessage) encode() (data []byte, e error) {
+	var id uint64
+	if len(d.SEID) != 0 {
+		if id, e = strconv.ParseUint(d.SEID, 16, 64); e != nil {
+			return
+		}
+	}
+	if len(d.Hex) != 0 {
+		if data, e = hex.DecodeString(d.Hex); e != nil || len(d.SEID) == 0 {
+			return
+		}
+		if len(data) < 12 || data[0]&0x01 != 0x01 {
+			e = fmt.Errorf("SEID can not be overridden in message without SEID")
+			return
+		}
+		binary.BigEndian.PutUint64(data[4:], id)
+		return
+	}
+
+	var buf *bytes.Buffer
+	if len(d.SEID) != 0 {
+		buf = bytes.NewBuffer([]byte{0x21, d.MessageType, 0x00, 0x00})
+		binary.Write(buf, binary.BigEndian, id)
+		buf.Write([]byte{0x00, 0x00, 0x00, 0x00})
+	} else {
+		buf = bytes.NewBuffer([]byte{
+			0x20, d.MessageType,
+			0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00})
+	}
+
+	for i, ie := range d.IEs {
+		var v []byte
+		if v, e = hex.DecodeString(ie.Data); e != nil {
+			e = fmt.Errorf("invalid data of IE #%d: %s", i, e)
+			return
+		}
+		binary.Write(buf, binary.BigEndian, ie.Type)
+		if ie.Length != nil {
+			binary.Write(buf, binary.BigEndian, *ie.Length)
+		} else {
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		}
+		buf.Write(v)
+	}
+
+	data = buf.Bytes()
+	l := len(data) - 4
+	if d.Length != nil {
+		l = int(*d.Length)
+	}
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+	return
+}
+
+func newRawMessage(m Message) RawMessage {
+	q := m.Sequence
+	d := RawMessage{
+		MessageType: m.MessageType,
+		Sequence:    &q,
+		IEs:         make([]RawIE, len(m.IEs))}
+	if m.SessionID != 0 {
+		d.SEID = strconv.FormatUint(m.SessionID, 16)
+	}
+	for i, ie := range m.IEs {
+		l := uint16(len(ie.Data))
+		d.IEs[i] = RawIE{
+			Type:   ie.IEType,
+			Name:   ieName(ie.IEType),
+			Length: &l,
+			Data:   hex.EncodeToString(ie.Data)}
+	}
+	return d
+}
+
+func handleMessagePOST(w http.ResponseWriter, r *http.Request) {
+	d := RawMessage{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	data, e := d.encode()
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	// position of sequence number in the header
+	p := 4
+	if len(data) != 0 && data[0]&0x01 == 0x01 {
+		p = 12
+	}
+	if len(data) < p+3 {
+		// no response can be waited for too short message
+		if e = writeData(data); e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "PFCP message handling failed",
+				Status:   http.StatusInternalServerError,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var q uint32
+	if d.Sequence != nil {
+		q = *d.Sequence & 0x00ffffff
+		data[p] = byte(q >> 16)
+		data[p+1] = byte(q >> 8)
+		data[p+2] = byte(q)
+	} else if len(d.Hex) != 0 {
+		q = uint32(data[p])<<16 | uint32(data[p+1])<<8 | uint32(data[p+2])
+	} else {
+		q = <-seq
+		seq <- q + 1
+		data[p] = byte(q >> 16)
+		data[p+1] = byte(q >> 8)
+		data[p+2] = byte(q)
+	}
+
+	m, e := sendMessage(data, q)
+	if e == errPendingSequence {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
+			Status:   http.StatusConflict,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	} else if m.MessageType == 0 {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
+			Status:   http.StatusGatewayTimeout,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	b, _ = json.Marshal(newRawMessage(m))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/fkgi/harico/pcap"
+	"github.com/fkgi/harico/pfcp"
+)
+
+type capturedMessage struct {
+	time time.Time
+	key  string // key of the response
+	msg  Message
+}
+
+func responseKey(src, dst fmt.Stringer, q uint32) string {
+	return fmt.Sprintf("%s>%s#%d", src, dst, q)
+}
+
+// replayPcap sends CP side PFCP session requests in the pcap file
+// with original timing, and compare responses with captured ones.
+// It returns number of unmatched responses.
+func replayPcap(path string) (int, error) {
+	pkts, e := pcap.ReadUDP(path)
+	if e != nil {
+		return 0, e
+	}
+
+	var reqs []capturedMessage
+	rsps := make(map[string]Message)
+	for _, p := range pkts {
+		if p.Src.Port != 8805 && p.Dst.Port != 8805 {
+			continue
+		}
+		m, e := pfcp.Parse(p.Payload)
+		if e != nil {
+			continue
+		}
+		switch m.MessageType {
+		case 50, 52, 54:
+			reqs = append(reqs, capturedMessage{
+				time: p.Time,
+				key:  responseKey(p.Dst, p.Src, m.Sequence),
+				msg:  m})
+		case 51, 53, 55:
+			rsps[responseKey(p.Src, p.Dst, m.Sequence)] = m
+		}
+	}
+	if len(reqs) == 0 {
+		return 0, fmt.Errorf("no PFCP session request in %s", path)
+	}
+	log.Printf("Replay: %d requests in %s", len(reqs), path)
+
+	cpSEID := make(map[uint64]uint64) // captured CP SEID -> local SEID
+	upSEID := make(map[uint64]uint64) // captured UP SEID -> local SEID
+	ng := 0
+	start := time.Now()
+	for i, r := range reqs {
+		if d := r.time.Sub(reqs[0].time) - time.Since(start); d > 0 {
+			time.Sleep(d)
+		}
+
+		var t *session
+		var lid uint64
+		if r.msg.MessageType != 50 {
+			if lid = upSEID[r.msg.SessionID]; lid != 0 {
+				t, _ = lookupSession(lid)
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		buf.Write([]byte{0x21, r.msg.MessageType, 0x00, 0x00})
+		if t != nil {
+			binary.Write(buf, binary.BigEndian, t.seid)
+		} else if r.msg.MessageType == 50 {
+			binary.Write(buf, binary.BigEndian, uint64(0))
+		} else {
+			log.Printf("Replay: #%d unknown SEID %x, sent as is",
+				i, r.msg.SessionID)
+			binary.Write(buf, binary.BigEndian, r.msg.SessionID)
+		}
+		buf.Write([]byte{0x00, 0x00, 0x00, 0x00})
+
+		for _, ie := range r.msg.IEs {
+			switch ie.IEType {
+			case 60:
+				nodeID(buf)
+			case 57:
+				cp := FSEID{}
+				cp.decode(ie.Data)
+				tunLock.Lock()
+				if lid = cpSEID[cp.ID]; lid == 0 {
+					for {
+						lid = rand.Uint64()
+						if _, ok := tun[lid]; !ok {
+							break
+						}
+					}
+					cpSEID[cp.ID] = lid
+				}
+				if t = tun[lid]; t == nil {
+					t = &session{
+						nodeid:  peerNode,
+						rxStack: make(chan ReportRequest, 128),
+						rules:   newRuleSet()}
+					tun[lid] = t
+				}
+				tunLock.Unlock()
+				sessionID(buf, lid)
+			default:
+				binary.Write(buf, binary.BigEndian, ie.IEType)
+				binary.Write(buf, binary.BigEndian, uint16(len(ie.Data)))
+				buf.Write(ie.Data)
+			}
+		}
+
+		m, e := writeMessage(buf.Bytes())
+		exp, ok := rsps[r.key]
+		var diff []string
+		if e != nil {
+			diff = []string{e.Error()}
+		} else if ok {
+			diff = compareMessage(exp, m)
+		}
+
+		if m.MessageType == 51 && t != nil {
+			for _, ie := range m.IEs {
+				if ie.IEType == 57 {
+					// t is already registered in tun
+					tunLock.Lock()
+					t.seid = decodeSessionID(ie.Data)
+					tunLock.Unlock()
+				}
+			}
+			for _, ie := range exp.IEs {
+				if ie.IEType == 57 {
+					upSEID[decodeSessionID(ie.Data)] = lid
+				}
+			}
+		}
+		tunLock.Lock()
+		if r.msg.MessageType == 50 && t != nil && t.seid == 0 {
+			delete(tun, lid)
+		}
+		if m.MessageType == 55 && lid != 0 {
+			delete(tun, lid)
+		}
+		tunLock.Unlock()
+
+		if !ok {
+			log.Printf("Replay: #%d %s: no captured response",
+				i, messageName(r.msg.MessageType))
+		} else if len(diff) == 0 {
+			log.Printf("Replay: #%d %s: OK",
+				i, messageName(r.msg.MessageType))
+		} else {
+			ng++
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Replay: #%d %s: NG\n",
+				i, messageName(r.msg.MessageType))
+			for _, d := range diff {
+				fmt.Fprintln(buf, " |", d)
+			}
+			log.Print(buf.String())
+		}
+	}
+
+	log.Printf("Replay: %d requests, %d unmatched", len(reqs), ng)
+	return ng, nil
+}
+
+// compareMessage returns differences of message type, cause and IE types
+func compareMessage(exp, m Message) (diff []string) {
+	if exp.MessageType != m.MessageType {
+		diff = append(diff, fmt.Sprintf("message type %s, expected %s",
+			messageName(m.MessageType), messageName(exp.MessageType)))
+		return
+	}
+
+	count := func(ies []IE) map[uint16]int {
+		c := make(map[uint16]int)
+		for _, ie := range ies {
+			c[ie.IEType]++
+		}
+		return c
+	}
+	ec, mc := count(exp.IEs), count(m.IEs)
+	var ts []int
+	for t := range ec {
+		ts = append(ts, int(t))
+	}
+	for t := range mc {
+		if _, ok := ec[t]; !ok {
+			ts = append(ts, int(t))
+		}
+	}
+	sort.Ints(ts)
+
+	for _, t := range ts {
+		if ec[uint16(t)] != mc[uint16(t)] {
+			diff = append(diff, fmt.Sprintf("%d %s IE, expected %d",
+				mc[uint16(t)], ieName(uint16(t)), ec[uint16(t)]))
+		}
+	}
+
+	var ecause, mcause byte
+	for _, ie := range exp.IEs {
+		if ie.IEType == 19 {
+			ecause = decodeCause(ie.Data)
+		}
+	}
+	for _, ie := range m.IEs {
+		if ie.IEType == 19 {
+			mcause = decodeCause(ie.Data)
+		}
+	}
+	if ecause != mcause {
+		diff = append(diff, fmt.Sprintf("cause %d (%s), expected %d (%s)",
+			mcause, Cause(mcause), ecause, Cause(ecause)))
+	}
+	return
+}
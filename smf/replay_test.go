@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareMessage(t *testing.T) {
+	accept := IE{IEType: 19, Data: []byte{1}}
+	reject := IE{IEType: 19, Data: []byte{64}}
+	node := IE{IEType: 60, Data: []byte{0, 127, 0, 0, 1}}
+	fseid := IE{IEType: 57, Data: make([]byte, 13)}
+	exp := Message{MessageType: 51, IEs: []IE{node, accept, fseid}}
+
+	for _, c := range []struct {
+		name string
+		m    Message
+		diff []string
+	}{
+		{"same", Message{MessageType: 51, IEs: []IE{fseid, node, accept}}, nil},
+		{"message type", Message{MessageType: 55, IEs: exp.IEs}, []string{
+			"message type " + messageName(55) + ", expected " + messageName(51)}},
+		{"IE count", Message{MessageType: 51, IEs: []IE{node, accept, fseid, fseid, {IEType: 40}}},
+			[]string{
+				"1 " + ieName(40) + " IE, expected 0",
+				"2 " + ieName(57) + " IE, expected 1"}},
+		{"cause", Message{MessageType: 51, IEs: []IE{node, reject}}, []string{
+			"0 " + ieName(57) + " IE, expected 1",
+			"cause 64 (" + Cause(64).String() + "), expected 1 (" + Cause(1).String() + ")"}},
+	} {
+		if d := compareMessage(exp, c.m); !reflect.DeepEqual(d, c.diff) {
+			t.Errorf("%s: diff is %q, expected %q", c.name, d, c.diff)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
-	"fmt"
 	"net/http"
 )
 
@@ -19,11 +18,38 @@ type DeletionResponse struct {
 	// Overload Control Information
 	// Usage Report
 	// Additional Usage Reports Information
-	// Packet Rate Status Report
+	PacketRateStatus []PacketRateStatusReport `json:"packetRateStatusReport,omitempty"`
 	// Session Report
 }
 
 func handleSessionDELETE(w http.ResponseWriter, r *http.Request, t *session, id uint64) {
+	res, e := deleteSession(t, id)
+	if ce, ok := e.(*causeError); ok {
+		errorResponse(w, ce.problem(r.URL.Path, nil))
+		return
+	} else if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	if res.PacketRateStatus == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// deleteSession sends Session Deletion Request and
+// removes the session and the PDU session if it is accepted
+func deleteSession(t *session, id uint64) (res DeletionResponse, e error) {
 	buf := bytes.NewBuffer([]byte{
 		0x21, 0x36,
 		0x00, 0x00})
@@ -31,34 +57,33 @@ func handleSessionDELETE(w http.ResponseWriter, r *http.Request, t *session, id
 	buf.Write([]byte{0x00, 0x00, 0x00, 0x00})
 
 	m, e := writeMessage(buf.Bytes())
-	res := DeletionResponse{}
 	if e == nil {
 		var cause byte
 		for _, ie := range m.IEs {
 			switch ie.IEType {
 			case 19:
 				cause = decodeCause(ie.Data)
+			case 252:
+				rep := PacketRateStatusReport{}
+				if e = rep.decode(ie.Data); e != nil {
+					break
+				}
+				res.PacketRateStatus = append(res.PacketRateStatus, rep)
 			}
 		}
 
 		if cause != 1 {
-			e = fmt.Errorf("PFCP error (cause=%d) from peer", cause)
+			ce := &causeError{}
+			ce.decode(m.IEs)
+			e = ce
 		}
 	}
 
-	if e != nil {
-		errorResponse(w, ProblemDetails{
-			Title:    "PFCP message handling failed",
-			Status:   http.StatusInternalServerError,
-			Detail:   e.Error(),
-			Instance: r.URL.Path})
-		return
+	if e == nil {
+		tunLock.Lock()
+		releasePDU(id)
+		delete(tun, id)
+		tunLock.Unlock()
 	}
-
-	delete(tun, id)
-
-	b, _ := json.Marshal(res)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNoContent)
-	w.Write(b)
+	return
 }
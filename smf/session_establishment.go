@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	"strconv"
+
+	"github.com/fkgi/harico/pfcp"
 )
 
 // EstablishmentRequest data
@@ -22,40 +25,50 @@ type EstablishmentRequest struct {
 	QER []CreateQER `json:"QER,omitempty"`
 	BAR *CreateBAR  `json:"BAR,omitempty"`
 	// Create Traffic Endpoint
-	PDNType         PDNType `json:"pdnType,omitempty"`
-	InactivityTimer uint32  `json:"inactivityTimer,omitempty"`
-	// User ID
-	// Trace Information
-	DNN string `json:"DNN,omitempty"`
-	// MAR
+	PDNType         PDNType           `json:"pdnType,omitempty"`
+	SMFFQCSID       *FQCSID           `json:"SMFFQCSID,omitempty"`
+	InactivityTimer uint32            `json:"inactivityTimer,omitempty"`
+	UserID          *UserID           `json:"userID,omitempty"`
+	Trace           *TraceInformation `json:"trace,omitempty"`
+	DNN             string            `json:"DNN,omitempty"`
+	MAR             []CreateMAR       `json:"MAR,omitempty"`
 	// PFCPSEReq-Flags
-	// Create Bridge Info for TSC string
-	// SRR
-	// Provide ATSSS Control Information
-	TimeStamp bool    `json:"timeStamp,omitempty"`
-	SNSSAI    *SNSSAI `json:"SNSSAI,omitempty"`
-	// Provide RDS configuration information
+	BridgeInfo bool          `json:"bridgeInfo,omitempty"`
+	SRR        []CreateSRR   `json:"SRR,omitempty"`
+	ATSSS      *ProvideATSSS `json:"ATSSS,omitempty"`
+	TimeStamp  bool          `json:"timeStamp,omitempty"`
+	SNSSAI     *SNSSAI       `json:"SNSSAI,omitempty"`
+	RDS        bool          `json:"RDS,omitempty"`
 }
 
 // EstablishmentResponse data
 type EstablishmentResponse struct {
 	ContextID string `json:"ID"`
-	// Node ID
+	NodeID    string `json:"nodeID,omitempty"`
 	// Cause
 	// Offending IE
-	// UP F-SEID
-	PDR []CreatedPDR `json:"PDR,omitempty"`
+	UPFSEID *FSEID       `json:"UPFSEID,omitempty"`
+	PDR     []CreatedPDR `json:"PDR,omitempty"`
 	// Load Control Information
 	// Overload Control Information
+	UPFFQCSID *FQCSID `json:"UPFFQCSID,omitempty"`
 	// Failed Rule ID
 	// Created Traffic Endpoint
-	// Created Bridge Info for TSC
-	// ATSSS Control Parameters
-	// RDS configuration information
+	BridgeInfo *CreatedBridgeInfo      `json:"bridgeInfo,omitempty"`
+	ATSSS      *ATSSSControlParameters `json:"ATSSS,omitempty"`
+	RDS        bool                    `json:"RDS,omitempty"`
 }
 
 func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
-	d := EstablishmentRequest{}
+	d, e := sessionTemplate(r)
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid template",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
 	b, e := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
@@ -67,18 +80,53 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 			Instance: r.URL.Path})
 		return
 	}
-	if e = json.Unmarshal(b, &d); e != nil {
+	if len(b) == 0 && len(r.URL.Query().Get("template")) != 0 {
+		// use the template as it is
+	} else if e = json.Unmarshal(b, &d); e != nil {
 		errorResponse(w, ProblemDetails{
 			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if ps := d.validate(); len(ps) != 0 && needValidation(r) {
+		errorResponse(w, ProblemDetails{
+			Title:         "invalid request",
+			Status:        http.StatusBadRequest,
+			Detail:        "session establishment request has invalid parameters",
+			Instance:      r.URL.Path,
+			InvalidParams: ps})
+		return
+	}
+
+	lid, res, e := establishSession(d)
+	if ce, ok := e.(*causeError); ok {
+		errorResponse(w, ce.problem(r.URL.Path, d.rulePath))
+		return
+	} else if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
 			Status:   http.StatusInternalServerError,
 			Detail:   e.Error(),
 			Instance: r.URL.Path})
 		return
 	}
 
-	var lid uint64
+	b, _ = json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/pfcp-cp/v1/session/"+strconv.FormatUint(lid, 16))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// establishSession sends Session Establishment Request and
+// registers the session if it is accepted
+func establishSession(d EstablishmentRequest) (lid uint64, res EstablishmentResponse, e error) {
 	s := session{
-		rxStack: make(chan ReportRequest, 128)}
+		rxStack: make(chan ReportRequest, 128),
+		rules:   newRuleSet()}
+	tunLock.Lock()
 	for {
 		lid = rand.Uint64()
 		if _, ok := tun[lid]; !ok {
@@ -86,6 +134,7 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
+	tunLock.Unlock()
 
 	buf := bytes.NewBuffer([]byte{
 		0x21, 0x32,
@@ -113,24 +162,49 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 	if d.PDNType != 0 {
 		d.PDNType.encode(buf)
 	}
+	if d.SMFFQCSID != nil {
+		d.SMFFQCSID.encode(buf)
+		s.csid = d.SMFFQCSID
+	}
 	if d.InactivityTimer != 0 {
 		buf.Write([]byte{0x00, 0x75, 0x00, 0x04})
 		binary.Write(buf, binary.BigEndian, d.InactivityTimer)
 	}
+	if d.UserID != nil {
+		d.UserID.encode(buf)
+	}
+	if d.Trace != nil {
+		d.Trace.encode(buf)
+	}
 	if len(d.DNN) != 0 {
 		data := []byte(d.DNN)
 		buf.Write([]byte{0x00, 0x9f, byte(len(data) >> 8), byte(len(data))})
 		buf.Write(data)
 	}
+	for _, p := range d.MAR {
+		p.encode(buf)
+	}
+	if d.BridgeInfo {
+		buf.Write([]byte{0x00, 0xc2, 0x00, 0x01, 0x01})
+	}
+	for _, p := range d.SRR {
+		p.encode(buf)
+	}
+	if d.ATSSS != nil {
+		d.ATSSS.encode(buf)
+	}
 	if d.TimeStamp {
 		recoveryTimeStamp(buf)
 	}
 	if d.SNSSAI != nil {
 		d.SNSSAI.encode(buf)
 	}
+	if d.RDS {
+		encodeRDS(buf)
+	}
 
 	m, e := writeMessage(buf.Bytes())
-	res := EstablishmentResponse{
+	res = EstablishmentResponse{
 		ContextID: strconv.FormatUint(lid, 16)}
 	if e == nil {
 		var cause byte
@@ -139,7 +213,19 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 			case 19:
 				cause = decodeCause(ie.Data)
 			case 57:
-				s.seid = decodeSessionID(ie.Data)
+				res.UPFSEID = &FSEID{}
+				if e := res.UPFSEID.decode(ie.Data); e != nil {
+					log.Printf("Rx PFCP: invalid UP F-SEID: %s", e)
+				}
+				s.seid = res.UPFSEID.ID
+			case 60:
+				s.nodeid, _ = pfcp.DecodeNodeID(ie.Data)
+			case 65:
+				res.UPFFQCSID = &FQCSID{}
+				if e := res.UPFFQCSID.decode(ie.Data); e != nil {
+					log.Printf("Rx PFCP: invalid UPF FQ-CSID: %s", e)
+				}
+				s.upCSID = res.UPFFQCSID
 			case 8:
 				pdr := CreatedPDR{}
 				if e := pdr.decode(ie.Data); e == nil {
@@ -149,38 +235,118 @@ func handleSessionPOST(w http.ResponseWriter, r *http.Request) {
 						res.PDR = append(res.PDR, pdr)
 					}
 				}
+			case 195:
+				res.BridgeInfo = &CreatedBridgeInfo{}
+				if e := res.BridgeInfo.decode(ie.Data); e != nil {
+					log.Printf("Rx PFCP: invalid Created Bridge Info for TSC: %s", e)
+				}
+			case 221:
+				res.ATSSS = &ATSSSControlParameters{}
+				if e := res.ATSSS.decode(ie.Data); e != nil {
+					log.Printf("Rx PFCP: invalid ATSSS Control Parameters: %s", e)
+				}
+			case 262:
+				res.RDS = len(ie.Data) != 0 && ie.Data[0]&0x01 == 0x01
 			}
 		}
 
 		if cause != 1 {
-			e = fmt.Errorf("PFCP error (cause=%d) from peer", cause)
+			ce := &causeError{}
+			ce.decode(m.IEs)
+			e = ce
 		}
 	}
 
 	if e != nil {
-		errorResponse(w, ProblemDetails{
-			Title:    "PFCP message handling failed",
-			Status:   http.StatusInternalServerError,
-			Detail:   e.Error(),
-			Instance: r.URL.Path})
+		tunLock.Lock()
 		delete(tun, lid)
+		tunLock.Unlock()
 		return
 	}
+	if len(s.nodeid) == 0 {
+		s.nodeid = peerNode
+	} else if s.nodeid != peerNode {
+		log.Printf("Rx PFCP: session is established on %s, not associated node %s",
+			s.nodeid, peerNode)
+	}
+	res.NodeID = s.nodeid
 
-	b, _ = json.Marshal(res)
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Location", "/pfcp-cp/v1/session/"+strconv.FormatUint(lid, 16))
-	w.WriteHeader(http.StatusCreated)
-	w.Write(b)
+	for _, p := range d.PDR {
+		s.rules.pdr[uint32(p.ID)] = true
+	}
+	for _, p := range d.FAR {
+		s.rules.far[p.ID] = true
+	}
+	for _, p := range d.URR {
+		s.rules.urr[p.ID] = true
+	}
+	for _, p := range d.QER {
+		s.rules.qer[p.ID] = true
+	}
+	for _, p := range d.MAR {
+		s.rules.mar[uint32(p.ID)] = true
+	}
+	for _, p := range d.SRR {
+		s.rules.srr[uint32(p.ID)] = true
+	}
+	return
+}
+
+func (d EstablishmentRequest) rulePath(r FailedRuleID) string {
+	switch r.Type {
+	case "PDR":
+		for i, p := range d.PDR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/PDR/%d", i)
+			}
+		}
+	case "FAR":
+		for i, p := range d.FAR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/FAR/%d", i)
+			}
+		}
+	case "URR":
+		for i, p := range d.URR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/URR/%d", i)
+			}
+		}
+	case "QER":
+		for i, p := range d.QER {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/QER/%d", i)
+			}
+		}
+	case "BAR":
+		if d.BAR != nil && uint32(d.BAR.ID) == r.ID {
+			return "/BAR"
+		}
+	case "MAR":
+		for i, p := range d.MAR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/MAR/%d", i)
+			}
+		}
+	case "SRR":
+		for i, p := range d.SRR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/SRR/%d", i)
+			}
+		}
+	}
+	return ""
 }
 
 func handleSessionLIST(w http.ResponseWriter, r *http.Request) {
+	tunLock.RLock()
 	res := make([]string, len(tun))
 	i := 0
 	for k := range tun {
 		res[i] = strconv.FormatUint(k, 16)
 		i++
 	}
+	tunLock.RUnlock()
 
 	b, _ := json.Marshal(res)
 	w.Header().Set("Content-Type", "application/json")
@@ -188,22 +354,23 @@ func handleSessionLIST(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+// sessionID writes CP F-SEID with local address of N4 and
+// dual-stack address if it is specified
 func sessionID(b *bytes.Buffer, id uint64) {
-	b.Write([]byte{0x00, 0x39})
-
-	if addr, ok := con.LocalAddr().(*net.UDPAddr); !ok {
-		b.Write([]byte{0x00, 0x00})
-	} else if ip := addr.IP.To4(); ip != nil {
-		b.Write([]byte{0x00, 0x0d, 0x02})
-		binary.Write(b, binary.BigEndian, id)
-		b.Write(ip)
-	} else if ip = addr.IP.To16(); ip != nil {
-		b.Write([]byte{0x00, 0x19, 0x01})
-		binary.Write(b, binary.BigEndian, id)
-		b.Write(ip)
-	} else {
-		b.Write([]byte{0x00, 0x00})
+	ie := FSEID{ID: id}
+	if addr, ok := con.LocalAddr().(*net.UDPAddr); ok {
+		ie.setAddr(addr.IP)
+	}
+	confLock.RLock()
+	if dualStack != nil {
+		ie.setAddr(dualStack)
+	}
+	confLock.RUnlock()
+	if ie.IPv4 == nil && ie.IPv6 == nil {
+		b.Write([]byte{0x00, 0x39, 0x00, 0x00})
+		return
 	}
+	ie.encode(b)
 }
 
 func decodeSessionID(b []byte) (id uint64) {
@@ -30,23 +30,23 @@ type ModificationRequest struct {
 	UpdateQER []UpdateQER `json:"updateQER,omitempty"`
 	UpdateBAR *UpdateBAR  `json:"updateBAR,omitempty"`
 	// Update Traffic Endpoint
-	// PFCPSMReq-Flags
-	// Query URR
-	InactivityTimer uint32 `json:"inactivityTimer,omitempty"`
-	// Query URR Reference
+	Flags           *PFCPSMReqFlags `json:"flags,omitempty"`
+	QueryURR        []uint32        `json:"queryURR,omitempty"`
+	InactivityTimer uint32          `json:"inactivityTimer,omitempty"`
+	QueryURRRef     uint32          `json:"queryURRReference,omitempty"`
 	// Trace Information
-	// Remove MAR
-	// Update MAR
-	// Create MAR
-	NodeID bool `json:"nodeID,omitempty"`
-	// TSC Management Information
-	// Remove SRR
-	// Create SRR
-	// Update SRR
-	// Provide ATSSS Control Information
+	RemoveMAR []RemoveMAR        `json:"removeMAR,omitempty"`
+	UpdateMAR []UpdateMAR        `json:"updateMAR,omitempty"`
+	CreateMAR []CreateMAR        `json:"createMAR,omitempty"`
+	NodeID    bool               `json:"nodeID,omitempty"`
+	TSC       *TSCManagementInfo `json:"TSC,omitempty"`
+	RemoveSRR []RemoveSRR        `json:"removeSRR,omitempty"`
+	CreateSRR []CreateSRR        `json:"createSRR,omitempty"`
+	UpdateSRR []UpdateSRR        `json:"updateSRR,omitempty"`
+	ATSSS     *ProvideATSSS      `json:"ATSSS,omitempty"`
 	// Ethernet Context Information
 	// Access Availability Information
-	// Query Packet Rate Status
+	QueryPacketRateStatus []uint32 `json:"queryPacketRateStatus,omitempty"`
 }
 
 // ModificationResponse data
@@ -56,14 +56,14 @@ type ModificationResponse struct {
 	CreatedPDR []CreatedPDR `json:"createdPDR,omitempty"`
 	// Load Control Information
 	// Overload Control Information
-	// Usage Report
+	UsageReport []UsageReport `json:"usageReport,omitempty"`
 	// Failed Rule ID
 	// Additional Usage Reports Information
 	// Created/Updated Traffic Endpoint
-	// TSC Management Information
-	// ATSSS Control Parameters
-	UpdatedPDR []UpdatedPDR `json:"updatedPDR,omitempty"`
-	// Packet Rate Status Report
+	TSC              *TSCManagementInfo       `json:"TSC,omitempty"`
+	ATSSS            *ATSSSControlParameters  `json:"ATSSS,omitempty"`
+	UpdatedPDR       []UpdatedPDR             `json:"updatedPDR,omitempty"`
+	PacketRateStatus []PacketRateStatusReport `json:"packetRateStatusReport,omitempty"`
 }
 
 func handleSessionPATCH(w http.ResponseWriter, r *http.Request, t *session, id uint64) {
@@ -82,12 +82,43 @@ func handleSessionPATCH(w http.ResponseWriter, r *http.Request, t *session, id u
 	if e = json.Unmarshal(b, &d); e != nil {
 		errorResponse(w, ProblemDetails{
 			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if ps := d.validate(t); len(ps) != 0 && needValidation(r) {
+		errorResponse(w, ProblemDetails{
+			Title:         "invalid request",
+			Status:        http.StatusBadRequest,
+			Detail:        "session modification request has invalid parameters",
+			Instance:      r.URL.Path,
+			InvalidParams: ps})
+		return
+	}
+
+	res, e := modifySession(t, id, d)
+	if ce, ok := e.(*causeError); ok {
+		errorResponse(w, ce.problem(r.URL.Path, d.rulePath))
+		return
+	} else if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
 			Status:   http.StatusInternalServerError,
 			Detail:   e.Error(),
 			Instance: r.URL.Path})
 		return
 	}
 
+	b, _ = json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// modifySession sends Session Modification Request and
+// updates rules of the session if it is accepted
+func modifySession(t *session, id uint64, d ModificationRequest) (res ModificationResponse, e error) {
 	buf := bytes.NewBuffer([]byte{
 		0x21, 0x34,
 		0x00, 0x00})
@@ -146,16 +177,54 @@ func handleSessionPATCH(w http.ResponseWriter, r *http.Request, t *session, id u
 		d.UpdateBAR.encode(buf)
 	}
 
+	if d.Flags != nil {
+		d.Flags.encode(buf)
+	}
+	for _, urr := range d.QueryURR {
+		buf.Write([]byte{0x00, 0x4d, 0x00, 0x08, 0x00, 0x51, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, urr)
+	}
 	if d.InactivityTimer != 0 {
 		buf.Write([]byte{0x00, 0x75, 0x00, 0x04})
 		binary.Write(buf, binary.BigEndian, d.InactivityTimer)
 	}
+	if d.QueryURRRef != 0 {
+		buf.Write([]byte{0x00, 0x7d, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, d.QueryURRRef)
+	}
+	for _, p := range d.RemoveMAR {
+		p.encode(buf)
+	}
+	for _, p := range d.UpdateMAR {
+		p.encode(buf)
+	}
+	for _, p := range d.CreateMAR {
+		p.encode(buf)
+	}
 	if d.NodeID {
 		nodeID(buf)
 	}
+	if d.TSC != nil {
+		d.TSC.encode(199, buf)
+	}
+	for _, p := range d.RemoveSRR {
+		p.encode(buf)
+	}
+	for _, p := range d.CreateSRR {
+		p.encode(buf)
+	}
+	for _, p := range d.UpdateSRR {
+		p.encode(buf)
+	}
+	if d.ATSSS != nil {
+		d.ATSSS.encode(buf)
+	}
+	for _, qer := range d.QueryPacketRateStatus {
+		buf.Write([]byte{0x01, 0x07, 0x00, 0x08, 0x00, 0x6d, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, qer)
+	}
 
 	m, e := writeMessage(buf.Bytes())
-	res := ModificationResponse{}
 	if e == nil {
 		var cause byte
 		for _, ie := range m.IEs {
@@ -171,6 +240,21 @@ func handleSessionPATCH(w http.ResponseWriter, r *http.Request, t *session, id u
 					break
 				}
 				res.CreatedPDR = append(res.CreatedPDR, pdr)
+			case 78:
+				if res.UsageReport == nil {
+					res.UsageReport = make([]UsageReport, 0)
+				}
+				ur := UsageReport{}
+				if e = ur.decode(ie.Data); e != nil {
+					break
+				}
+				res.UsageReport = append(res.UsageReport, ur)
+			case 200:
+				res.TSC = &TSCManagementInfo{}
+				e = res.TSC.decode(ie.Data)
+			case 221:
+				res.ATSSS = &ATSSSControlParameters{}
+				e = res.ATSSS.decode(ie.Data)
 			case 256:
 				if res.UpdatedPDR == nil {
 					res.UpdatedPDR = make([]UpdatedPDR, 0)
@@ -180,25 +264,197 @@ func handleSessionPATCH(w http.ResponseWriter, r *http.Request, t *session, id u
 					break
 				}
 				res.UpdatedPDR = append(res.UpdatedPDR, pdr)
+			case 264:
+				if res.PacketRateStatus == nil {
+					res.PacketRateStatus = make([]PacketRateStatusReport, 0)
+				}
+				rep := PacketRateStatusReport{}
+				if e = rep.decode(ie.Data); e != nil {
+					break
+				}
+				res.PacketRateStatus = append(res.PacketRateStatus, rep)
 			}
 		}
 
 		if cause != 1 {
-			e = fmt.Errorf("PFCP error (cause=%d) from peer", cause)
+			ce := &causeError{}
+			ce.decode(m.IEs)
+			e = ce
 		}
 	}
 
 	if e != nil {
-		errorResponse(w, ProblemDetails{
-			Title:    "PFCP message handling failed",
-			Status:   http.StatusInternalServerError,
-			Detail:   e.Error(),
-			Instance: r.URL.Path})
 		return
 	}
 
-	b, _ = json.Marshal(res)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(b)
+	for _, p := range d.RemovePDR {
+		delete(t.rules.pdr, uint32(p.ID))
+	}
+	for _, p := range d.RemoveFAR {
+		delete(t.rules.far, p.ID)
+	}
+	for _, p := range d.RemoveURR {
+		delete(t.rules.urr, p.ID)
+	}
+	for _, p := range d.RemoveQER {
+		delete(t.rules.qer, p.ID)
+	}
+	for _, p := range d.CreatePDR {
+		t.rules.pdr[uint32(p.ID)] = true
+	}
+	for _, p := range d.CreateFAR {
+		t.rules.far[p.ID] = true
+	}
+	for _, p := range d.CreateURR {
+		t.rules.urr[p.ID] = true
+	}
+	for _, p := range d.CreateQER {
+		t.rules.qer[p.ID] = true
+	}
+	for _, p := range d.RemoveMAR {
+		delete(t.rules.mar, uint32(p.ID))
+	}
+	for _, p := range d.CreateMAR {
+		t.rules.mar[uint32(p.ID)] = true
+	}
+	for _, p := range d.RemoveSRR {
+		delete(t.rules.srr, uint32(p.ID))
+	}
+	for _, p := range d.CreateSRR {
+		t.rules.srr[uint32(p.ID)] = true
+	}
+	return
+}
+
+func (d ModificationRequest) rulePath(r FailedRuleID) string {
+	switch r.Type {
+	case "PDR":
+		for i, p := range d.CreatePDR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/createPDR/%d", i)
+			}
+		}
+		for i, p := range d.UpdatePDR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/updatePDR/%d", i)
+			}
+		}
+		for i, p := range d.RemovePDR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/removePDR/%d", i)
+			}
+		}
+	case "FAR":
+		for i, p := range d.CreateFAR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/createFAR/%d", i)
+			}
+		}
+		for i, p := range d.UpdateFAR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/updateFAR/%d", i)
+			}
+		}
+		for i, p := range d.RemoveFAR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/removeFAR/%d", i)
+			}
+		}
+	case "URR":
+		for i, p := range d.CreateURR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/createURR/%d", i)
+			}
+		}
+		for i, p := range d.UpdateURR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/updateURR/%d", i)
+			}
+		}
+		for i, p := range d.RemoveURR {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/removeURR/%d", i)
+			}
+		}
+	case "QER":
+		for i, p := range d.CreateQER {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/createQER/%d", i)
+			}
+		}
+		for i, p := range d.UpdateQER {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/updateQER/%d", i)
+			}
+		}
+		for i, p := range d.RemoveQER {
+			if p.ID == r.ID {
+				return fmt.Sprintf("/removeQER/%d", i)
+			}
+		}
+	case "BAR":
+		if d.CreateBAR != nil && uint32(d.CreateBAR.ID) == r.ID {
+			return "/createBAR"
+		}
+		if d.UpdateBAR != nil && uint32(d.UpdateBAR.ID) == r.ID {
+			return "/updateBAR"
+		}
+		if d.RemoveBAR != nil && uint32(d.RemoveBAR.ID) == r.ID {
+			return "/removeBAR"
+		}
+	case "MAR":
+		for i, p := range d.CreateMAR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/createMAR/%d", i)
+			}
+		}
+		for i, p := range d.UpdateMAR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/updateMAR/%d", i)
+			}
+		}
+		for i, p := range d.RemoveMAR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/removeMAR/%d", i)
+			}
+		}
+	case "SRR":
+		for i, p := range d.CreateSRR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/createSRR/%d", i)
+			}
+		}
+		for i, p := range d.UpdateSRR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/updateSRR/%d", i)
+			}
+		}
+		for i, p := range d.RemoveSRR {
+			if uint32(p.ID) == r.ID {
+				return fmt.Sprintf("/removeSRR/%d", i)
+			}
+		}
+	}
+	return ""
+}
+
+// PFCPSMReqFlags IE
+type PFCPSMReqFlags struct {
+	DROBU bool `json:"DROBU,omitempty"`
+	SNDEM bool `json:"SNDEM,omitempty"`
+	QAURR bool `json:"QAURR,omitempty"`
+}
+
+func (ie PFCPSMReqFlags) encode(b *bytes.Buffer) {
+	var f byte = 0x00
+	if ie.DROBU {
+		f = f | 0x01
+	}
+	if ie.SNDEM {
+		f = f | 0x02
+	}
+	if ie.QAURR {
+		f = f | 0x04
+	}
+	b.Write([]byte{0x00, 0x31, 0x00, 0x01, f})
 }
@@ -6,8 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // ReportRequest data
@@ -22,29 +27,113 @@ type ReportRequest struct {
 		DLDR bool `json:"DLDR,omitempty"`
 	} `json:"type"`
 	DownlinkData *DownlinkData `json:"downlinkData,omitempty"`
-	/*
-		Usage
-	*/
-	// Error Indication Report
-	// Load Control Information
-	// Overload Control Information
-	// Additional Usage Reports Information
-	// PFCPSRReq-Flags
-	// Old CP F-SEID
+	UsageReport  []UsageReport `json:"usageReport,omitempty"`
+
+	ErrorIndication        *ErrorIndicationReport      `json:"errorIndicationReport,omitempty"`
+	LoadControl            *LoadControlInformation     `json:"loadControlInformation,omitempty"`
+	OverloadControl        *OverloadControlInformation `json:"overloadControlInformation,omitempty"`
+	AdditionalUsageReports *AdditionalUsageReports     `json:"additionalUsageReportsInformation,omitempty"`
+	Flags                  *PFCPSRReqFlags             `json:"flags,omitempty"`
+	OldCPFSEID             *FSEID                      `json:"oldCPFSEID,omitempty"`
 	// Packet Rate Status Report
-	// TSC Management Information
-	// Session Report
+	TSC           *TSCManagementInfo `json:"TSC,omitempty"`
+	SessionReport []SessionReport    `json:"sessionReport,omitempty"`
 }
 
 // ReportResponse data
 type ReportResponse struct {
-	// Cause
-	// Offending IE
-	// Update BAR
-	// PFCPSRRsp-Flags
-	// CP F-SEID
+	Cause       byte             `json:"cause,omitempty"`
+	OffendingIE uint16           `json:"offendingIE,omitempty"`
+	UpdateBAR   *ReportUpdateBAR `json:"updateBAR,omitempty"`
+	Flags       *PFCPSRRspFlags  `json:"flags,omitempty"`
+	CPFSEID     *FSEID           `json:"CPFSEID,omitempty"`
 	// N4-u F-TEID
-	// Alternative SMF IP Address
+	AltSMFIP net.IP `json:"alternativeSMFIP,omitempty"`
+
+	// Delay is waiting time in millisecond before sending response
+	Delay uint32 `json:"delay,omitempty"`
+	// NoResponse discards the request without response
+	NoResponse bool `json:"noResponse,omitempty"`
+	// Count is number of reports this policy applied,
+	// the policy is removed after the count. 0 means unlimited.
+	Count uint32 `json:"count,omitempty"`
+}
+
+var reportPolicy *ReportResponse
+
+// PFCPSRReqFlags IE
+type PFCPSRReqFlags struct {
+	PSDBU bool `json:"PSDBU,omitempty"`
+}
+
+// ErrorIndicationReport IE
+type ErrorIndicationReport struct {
+	RemoteFTEID []FTEID `json:"remoteFTEID"`
+}
+
+func (ie *ErrorIndicationReport) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 21:
+			fteid := FTEID{}
+			if e = fteid.decode(b); e == nil {
+				ie.RemoteFTEID = append(ie.RemoteFTEID, fteid)
+			}
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+// AdditionalUsageReports indicate Additional Usage Reports Information IE
+type AdditionalUsageReports struct {
+	AURI   bool   `json:"AURI,omitempty"`
+	Number uint16 `json:"number,omitempty"`
+}
+
+func (ie *AdditionalUsageReports) decode(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("invalid data")
+	}
+	ie.AURI = b[0]&0x80 == 0x80
+	if len(b) > 1 {
+		ie.Number = uint16(b[0]&0x7f)<<8 | uint16(b[1])
+	}
+	return nil
+}
+
+// PFCPSRRspFlags IE
+type PFCPSRRspFlags struct {
+	DROBU bool `json:"DROBU,omitempty"`
+}
+
+func (ie PFCPSRRspFlags) encode(b *bytes.Buffer) {
+	var f byte = 0x00
+	if ie.DROBU {
+		f = f | 0x01
+	}
+	b.Write([]byte{0x00, 0x32, 0x00, 0x01, f})
 }
 
 func handleSessionGET(w http.ResponseWriter, r *http.Request, t *session) {
@@ -54,29 +143,121 @@ func handleSessionGET(w http.ResponseWriter, r *http.Request, t *session) {
 	w.Write(b)
 }
 
+// handleReportPUT sets report response policy of the session lid,
+// or global policy if lid is 0.
+func handleReportPUT(w http.ResponseWriter, r *http.Request, p **ReportResponse, lid uint64) {
+	d := ReportResponse{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	// policy is guarded by tunLock, it is read and replaced in report handling
+	var reason string
+	tunLock.Lock()
+	if d.CPFSEID != nil && d.CPFSEID.ID != 0 {
+		if lid == 0 {
+			reason = "fixed ID is not allowed in global policy"
+		} else if t, ok := tun[d.CPFSEID.ID]; ok && t != tun[lid] {
+			reason = fmt.Sprintf("ID %x is used by other session", d.CPFSEID.ID)
+		}
+	}
+	if len(reason) == 0 {
+		*p = &d
+	}
+	tunLock.Unlock()
+
+	if len(reason) != 0 {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   "report response policy has invalid parameters",
+			Instance: r.URL.Path,
+			InvalidParams: []InvalidParam{{
+				Param: "/CPFSEID/ID", Reason: reason}}})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleReportGET(w http.ResponseWriter, r *http.Request, p **ReportResponse) {
+	tunLock.RLock()
+	d := *p
+	tunLock.RUnlock()
+	if d == nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "context not found",
+			Status:   http.StatusNotFound,
+			Detail:   "no report response policy",
+			Instance: r.URL.Path})
+		return
+	}
+
+	b, _ := json.Marshal(d)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handleReportDELETE(w http.ResponseWriter, r *http.Request, p **ReportResponse) {
+	tunLock.Lock()
+	*p = nil
+	tunLock.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveSession changes local SEID of the session t and the PDU session
+// from old to id, new random ID is used if id is 0
+func moveSession(t *session, old, id uint64) (uint64, error) {
+	tunLock.Lock()
+	defer tunLock.Unlock()
+	for id == 0 {
+		if id = rand.Uint64(); tun[id] != nil {
+			id = 0
+		}
+	}
+	if o, ok := tun[id]; ok && o != t {
+		return id, fmt.Errorf("CP F-SEID %x is used by other session", id)
+	}
+	if old == id {
+		return id, nil
+	}
+	tun[id] = tun[old]
+	delete(tun, old)
+	if c, ok := pdus[old]; ok {
+		c.ID = strconv.FormatUint(id, 16)
+		pdus[id] = c
+		delete(pdus, old)
+	}
+	return id, nil
+}
+
 func handleSessionReport(m Message) {
 	buf := bytes.NewBuffer([]byte{
 		0x21, 0x39,
 		0x00, 0x00})
-	if t, ok := tun[m.SessionID]; !ok {
+	if t, ok := lookupSession(m.SessionID); !ok {
 		buf.Write([]byte{
 			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 			byte(m.Sequence >> 16), byte(m.Sequence >> 8), byte(m.Sequence),
 			0x00})
 		encodeCause(65, buf)
 	} else {
-		binary.Write(buf, binary.BigEndian, t.seid)
-		buf.Write([]byte{
-			byte(m.Sequence >> 16), byte(m.Sequence >> 8), byte(m.Sequence),
-			0x00})
-		encodeCause(1, buf)
-		// Offending IE
-		// Update BAR
-		// PFCPSRRsp-Flags
-		// CP F-SEID
-		// N4-u F-TEID
-		// Alternative SMF IP Address
-
 		req := ReportRequest{}
 		for _, ie := range m.IEs {
 			switch ie.IEType {
@@ -94,9 +275,133 @@ func handleSessionReport(m Message) {
 					break
 				}
 			case 80:
+				ur := UsageReport{}
+				if e := ur.decode(ie.Data); e != nil {
+					break
+				}
+				req.UsageReport = append(req.UsageReport, ur)
+			case 99:
+				req.ErrorIndication = &ErrorIndicationReport{}
+				if e := req.ErrorIndication.decode(ie.Data); e != nil {
+					break
+				}
+			case 51:
+				req.LoadControl = &LoadControlInformation{}
+				if e := req.LoadControl.decode(ie.Data); e != nil {
+					break
+				}
+			case 54:
+				req.OverloadControl = &OverloadControlInformation{}
+				if e := req.OverloadControl.decode(ie.Data); e != nil {
+					break
+				}
+			case 126:
+				req.AdditionalUsageReports = &AdditionalUsageReports{}
+				if e := req.AdditionalUsageReports.decode(ie.Data); e != nil {
+					break
+				}
+			case 161:
+				if len(ie.Data) != 0 {
+					req.Flags = &PFCPSRReqFlags{
+						PSDBU: ie.Data[0]&0x01 == 0x01}
+				}
+			case 57:
+				req.OldCPFSEID = &FSEID{}
+				if e := req.OldCPFSEID.decode(ie.Data); e != nil {
+					break
+				}
+			case 201:
+				req.TSC = &TSCManagementInfo{}
+				if e := req.TSC.decode(ie.Data); e != nil {
+					break
+				}
+			case 214:
+				sr := SessionReport{}
+				if e := sr.decode(ie.Data); e != nil {
+					break
+				}
+				req.SessionReport = append(req.SessionReport, sr)
+			}
+		}
+
+		// policy is replaced with decremented copy,
+		// since the current one may be marshalled by GET
+		tunLock.Lock()
+		pp := &t.report
+		if *pp == nil {
+			pp = &reportPolicy
+		}
+		p := *pp
+		if p == nil {
+			p = &ReportResponse{}
+		} else if p.Count != 0 {
+			n := *p
+			if n.Count--; n.Count == 0 {
+				*pp = nil
+			} else {
+				*pp = &n
 			}
 		}
+		tunLock.Unlock()
+
+		binary.Write(buf, binary.BigEndian, t.seid)
+		buf.Write([]byte{
+			byte(m.Sequence >> 16), byte(m.Sequence >> 8), byte(m.Sequence),
+			0x00})
+		if p.Cause != 0 {
+			encodeCause(p.Cause, buf)
+		} else {
+			encodeCause(1, buf)
+		}
+		if p.OffendingIE != 0 {
+			buf.Write([]byte{0x00, 0x28, 0x00, 0x02})
+			binary.Write(buf, binary.BigEndian, p.OffendingIE)
+		}
+		if p.UpdateBAR != nil && req.ReportTye.DLDR {
+			p.UpdateBAR.encode(buf)
+		}
+		if p.Flags != nil {
+			p.Flags.encode(buf)
+		}
+		if p.CPFSEID != nil {
+			if id, e := moveSession(t, m.SessionID, p.CPFSEID.ID); e != nil {
+				log.Printf("Rx PFCP: %s", e)
+			} else {
+				FSEID{ID: id, IPv4: p.CPFSEID.IPv4, IPv6: p.CPFSEID.IPv6}.encode(buf)
+				log.Printf("Rx PFCP: session %x is moved to %x",
+					m.SessionID, id)
+			}
+		}
+		// N4-u F-TEID
+		if p.AltSMFIP != nil {
+			if ip := p.AltSMFIP.To4(); ip != nil {
+				buf.Write([]byte{0x00, 0xb2, 0x00, 0x05, 0x02})
+				buf.Write(ip)
+			} else {
+				buf.Write([]byte{0x00, 0xb2, 0x00, 0x11, 0x01})
+				buf.Write(p.AltSMFIP.To16())
+			}
+		}
+
 		t.rxStack <- req
+
+		if p.NoResponse {
+			log.Printf("Rx PFCP: session report response is discarded")
+			return
+		}
+		if p.Delay != 0 {
+			data := buf.Bytes()
+			l := len(data) - 4
+			data[2] = byte(l >> 8)
+			data[3] = byte(l)
+
+			time.AfterFunc(time.Millisecond*time.Duration(p.Delay), func() {
+				if e := writeData(data); e != nil {
+					log.Println(e)
+				}
+			})
+			return
+		}
 	}
 
 	data := buf.Bytes()
@@ -104,7 +409,7 @@ func handleSessionReport(m Message) {
 	data[2] = byte(l >> 8)
 	data[3] = byte(l)
 
-	_, e := con.Write(data)
+	e := writeData(data)
 	if e != nil {
 		log.Println(e)
 	}
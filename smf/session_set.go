@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// SetDeletionRequest data
+type SetDeletionRequest struct {
+	// Node ID
+	SMFFQCSID *FQCSID `json:"SMFFQCSID,omitempty"`
+}
+
+// SetDeletionResponse data
+type SetDeletionResponse struct {
+	// Node ID
+	// Cause
+	// Offending IE
+	Sessions []string `json:"sessions"` // deleted local session IDs
+}
+
+// SetModificationRequest data
+type SetModificationRequest struct {
+	AlternativeSMF AlternativeIP `json:"alternativeSMF"`
+	SMFFQCSID      *FQCSID       `json:"SMFFQCSID,omitempty"`
+	// Group Id
+	// CP IP Address
+}
+
+func handleSetDeletionPOST(w http.ResponseWriter, r *http.Request) {
+	d := SetDeletionRequest{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if len(b) == 0 {
+		// delete all sessions of the node
+	} else if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{
+		0x20, 0x0e,
+		0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00})
+	nodeID(buf)
+	if d.SMFFQCSID != nil {
+		d.SMFFQCSID.encode(buf)
+	}
+
+	if e = writeSetMessage(buf.Bytes()); e != nil {
+		if ce, ok := e.(*causeError); ok {
+			errorResponse(w, ce.problem(r.URL.Path, nil))
+		} else {
+			errorResponse(w, ProblemDetails{
+				Title:    "PFCP message handling failed",
+				Status:   http.StatusInternalServerError,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+		}
+		return
+	}
+
+	res := SetDeletionResponse{Sessions: []string{}}
+	tunLock.Lock()
+	for id, t := range tun {
+		if d.SMFFQCSID == nil || (t.csid != nil && t.csid.match(*d.SMFFQCSID)) {
+			releasePDU(id)
+			delete(tun, id)
+			res.Sessions = append(res.Sessions, strconv.FormatUint(id, 16))
+		}
+	}
+	tunLock.Unlock()
+
+	b, _ = json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handleSetModificationPOST(w http.ResponseWriter, r *http.Request) {
+	d := SetModificationRequest{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if needValidation(r) && d.AlternativeSMF.IPv4 == nil && d.AlternativeSMF.IPv6 == nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid request",
+			Status:   http.StatusBadRequest,
+			Detail:   "session set modification request has invalid parameters",
+			Instance: r.URL.Path,
+			InvalidParams: []InvalidParam{{
+				Param:  "/alternativeSMF",
+				Reason: "no IPv4 or IPv6 address"}}})
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{
+		0x20, 0x10,
+		0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00})
+	d.AlternativeSMF.encode(buf)
+	if d.SMFFQCSID != nil {
+		d.SMFFQCSID.encode(buf)
+	}
+
+	if e = writeSetMessage(buf.Bytes()); e != nil {
+		if ce, ok := e.(*causeError); ok {
+			errorResponse(w, ce.problem(r.URL.Path, nil))
+		} else {
+			errorResponse(w, ProblemDetails{
+				Title:    "PFCP message handling failed",
+				Status:   http.StatusInternalServerError,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSetMessage sends session set request and checks cause of the response
+func writeSetMessage(data []byte) error {
+	m, e := writeMessage(data)
+	if e != nil {
+		return e
+	}
+	for _, ie := range m.IEs {
+		if ie.IEType == 19 && decodeCause(ie.Data) != 1 {
+			ce := &causeError{}
+			ce.decode(m.IEs)
+			return ce
+		}
+	}
+	return nil
+}
+
+// handleSetDeletion deletes sessions of the peer which match
+// the FQ-CSIDs in UPF initiated Session Set Deletion Request.
+func handleSetDeletion(m Message) {
+	var node string
+	var csids []FQCSID
+	for _, ie := range m.IEs {
+		switch ie.IEType {
+		case 60:
+			node, _ = pfcp.DecodeNodeID(ie.Data)
+		case 65:
+			c := FQCSID{}
+			if e := c.decode(ie.Data); e != nil {
+				log.Printf("Rx PFCP: invalid FQ-CSID: %s", e)
+				continue
+			}
+			csids = append(csids, c)
+		}
+	}
+
+	var cause byte = 1
+	if len(node) == 0 {
+		cause = 66
+	}
+	tunLock.Lock()
+	for id, t := range tun {
+		if cause != 1 || t.nodeid != node {
+			continue
+		}
+		match := len(csids) == 0
+		for _, c := range csids {
+			if t.upCSID != nil && t.upCSID.match(c) {
+				match = true
+			}
+		}
+		if match {
+			log.Printf("Rx PFCP: session %x is deleted", id)
+			releasePDU(id)
+			delete(tun, id)
+		}
+	}
+	tunLock.Unlock()
+
+	buf := bytes.NewBuffer([]byte{
+		0x20, 0x0f,
+		0x00, 0x00,
+		byte(m.Sequence >> 16), byte(m.Sequence >> 8), byte(m.Sequence), 0x00})
+	nodeID(buf)
+	encodeCause(cause, buf)
+	if cause == 66 {
+		buf.Write([]byte{0x00, 0x28, 0x00, 0x02, 0x00, 0x3c})
+	}
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+
+	if e := writeData(data); e != nil {
+		log.Printf("Rx PFCP: session set deletion handling failed: %s", e)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// CreateSRR IE
+type CreateSRR struct {
+	ID            byte                   `json:"ID"`
+	QoSMonitoring []QoSMonitoringControl `json:"QoSMonitoring,omitempty"`
+	// Direct Reporting Information
+}
+
+func (ie CreateSRR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(212))
+	buf := bytes.NewBuffer([]byte{0x00, 0xd7, 0x00, 0x01, ie.ID})
+
+	for _, c := range ie.QoSMonitoring {
+		c.encode(buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// UpdateSRR IE
+type UpdateSRR struct {
+	ID            byte                   `json:"ID"`
+	QoSMonitoring []QoSMonitoringControl `json:"QoSMonitoring,omitempty"`
+	// Direct Reporting Information
+}
+
+func (ie UpdateSRR) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(213))
+	buf := bytes.NewBuffer([]byte{0x00, 0xd7, 0x00, 0x01, ie.ID})
+
+	for _, c := range ie.QoSMonitoring {
+		c.encode(buf)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// RemoveSRR IE
+type RemoveSRR struct {
+	ID byte `json:"ID"`
+}
+
+func (ie RemoveSRR) encode(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0xd3, 0x00, 0x05, 0x00, 0xd7, 0x00, 0x01, ie.ID})
+}
+
+// QoSMonitoringControl is QoS Monitoring per QoS flow Control Information IE
+type QoSMonitoringControl struct {
+	QFI               []int                 `json:"QFI"`
+	Requested         QoSMonitoringFlags    `json:"requestedQoSMonitoring"`
+	Frequency         ReportingFrequency    `json:"reportingFrequency"`
+	Thresholds        *PacketDelayThreshold `json:"packetDelayThresholds,omitempty"`
+	MinimumWaitTime   uint32                `json:"minimumWaitTime,omitempty"`
+	MeasurementPeriod uint32                `json:"measurementPeriod,omitempty"`
+	// QoS Monitoring Reporting Frequency
+}
+
+func (ie QoSMonitoringControl) encode(b *bytes.Buffer) {
+	binary.Write(b, binary.BigEndian, uint16(242))
+	buf := new(bytes.Buffer)
+
+	for _, qfi := range ie.QFI {
+		buf.Write([]byte{0x00, 0x7c, 0x00, 0x01, byte(qfi) & 0x3f})
+	}
+	buf.Write([]byte{0x00, 0xf3, 0x00, 0x01, ie.Requested.flags()})
+	buf.Write([]byte{0x00, 0xf4, 0x00, 0x01, ie.Frequency.flags()})
+	if ie.Thresholds != nil {
+		ie.Thresholds.encode(buf)
+	}
+	if ie.MinimumWaitTime != 0 {
+		buf.Write([]byte{0x00, 0xf6, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.MinimumWaitTime)
+	}
+	if ie.MeasurementPeriod != 0 {
+		buf.Write([]byte{0x00, 0x40, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.MeasurementPeriod)
+	}
+
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// QoSMonitoringFlags is Requested QoS Monitoring IE
+type QoSMonitoringFlags struct {
+	DL bool `json:"DL,omitempty"`
+	UL bool `json:"UL,omitempty"`
+	RP bool `json:"RP,omitempty"`
+}
+
+func (ie QoSMonitoringFlags) flags() (f byte) {
+	if ie.DL {
+		f = f | 0x01
+	}
+	if ie.UL {
+		f = f | 0x02
+	}
+	if ie.RP {
+		f = f | 0x04
+	}
+	return
+}
+
+// ReportingFrequency IE
+type ReportingFrequency struct {
+	EVETT bool `json:"EVETT,omitempty"`
+	PERIO bool `json:"PERIO,omitempty"`
+	SESRL bool `json:"SESRL,omitempty"`
+}
+
+func (ie ReportingFrequency) flags() (f byte) {
+	if ie.EVETT {
+		f = f | 0x01
+	}
+	if ie.PERIO {
+		f = f | 0x02
+	}
+	if ie.SESRL {
+		f = f | 0x04
+	}
+	return
+}
+
+// PacketDelayThreshold is Packet Delay Thresholds IE in millisecond
+type PacketDelayThreshold struct {
+	DL *uint32 `json:"downlink,omitempty"`
+	UL *uint32 `json:"uplink,omitempty"`
+	RP *uint32 `json:"roundTrip,omitempty"`
+}
+
+func (ie PacketDelayThreshold) encode(b *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	var f byte
+	for i, v := range []*uint32{ie.DL, ie.UL, ie.RP} {
+		if v != nil {
+			f = f | 0x01<<uint(i)
+			binary.Write(buf, binary.BigEndian, *v)
+		}
+	}
+	b.Write([]byte{0x00, 0xf5})
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()+1))
+	b.WriteByte(f)
+	buf.WriteTo(b)
+}
+
+// SessionReport IE
+type SessionReport struct {
+	SRR byte `json:"SRR"`
+	// Access Availability Report
+	QoSMonitoring []QoSMonitoringReport `json:"QoSMonitoringReport,omitempty"`
+}
+
+func (ie *SessionReport) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 215:
+			if len(i.Data) < 1 {
+				return fmt.Errorf("invalid SRR ID")
+			}
+			ie.SRR = i.Data[0]
+		case 247:
+			r := QoSMonitoringReport{}
+			if e = r.decode(i.Data); e != nil {
+				return
+			}
+			ie.QoSMonitoring = append(ie.QoSMonitoring, r)
+		}
+	}
+	return
+}
+
+// QoSMonitoringReport IE
+type QoSMonitoringReport struct {
+	QFI         byte                     `json:"QFI"`
+	Measurement QoSMonitoringMeasurement `json:"measurement"`
+	TimeStamp   *time.Time               `json:"timeStamp,omitempty"`
+	Start       *time.Time               `json:"startTime,omitempty"`
+}
+
+func (ie *QoSMonitoringReport) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 124:
+			if len(i.Data) < 1 {
+				return fmt.Errorf("invalid QFI")
+			}
+			ie.QFI = i.Data[0] & 0x3f
+		case 248:
+			e = ie.Measurement.decode(i.Data)
+		case 156:
+			ie.TimeStamp, e = decodeTimeStamp(i.Data)
+		case 75:
+			ie.Start, e = decodeTimeStamp(i.Data)
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+// QoSMonitoringMeasurement IE, packet delays are in millisecond
+type QoSMonitoringMeasurement struct {
+	DL   *uint32 `json:"downlinkDelay,omitempty"`
+	UL   *uint32 `json:"uplinkDelay,omitempty"`
+	RP   *uint32 `json:"roundTripDelay,omitempty"`
+	PLMF bool    `json:"measurementFailure,omitempty"`
+}
+
+func (ie *QoSMonitoringMeasurement) decode(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("invalid data")
+	}
+	f := b[0]
+	ie.PLMF = f&0x08 == 0x08
+	b = b[1:]
+	for i, v := range []**uint32{&ie.DL, &ie.UL, &ie.RP} {
+		if f&(0x01<<uint(i)) == 0 {
+			continue
+		}
+		if len(b) < 4 {
+			return fmt.Errorf("invalid data")
+		}
+		d := binary.BigEndian.Uint32(b)
+		*v = &d
+		b = b[4:]
+	}
+	return nil
+}
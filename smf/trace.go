@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+var (
+	verbose   = false
+	traceFile *os.File
+	traceLock sync.Mutex
+)
+
+var messageNames = map[byte]string{
+	1:  "Heartbeat Request",
+	2:  "Heartbeat Response",
+	3:  "PFD Management Request",
+	4:  "PFD Management Response",
+	5:  "Association Setup Request",
+	6:  "Association Setup Response",
+	7:  "Association Update Request",
+	8:  "Association Update Response",
+	9:  "Association Release Request",
+	10: "Association Release Response",
+	11: "Version Not Supported Response",
+	12: "Node Report Request",
+	13: "Node Report Response",
+	14: "Session Set Deletion Request",
+	15: "Session Set Deletion Response",
+	16: "Session Set Modification Request",
+	17: "Session Set Modification Response",
+	50: "Session Establishment Request",
+	51: "Session Establishment Response",
+	52: "Session Modification Request",
+	53: "Session Modification Response",
+	54: "Session Deletion Request",
+	55: "Session Deletion Response",
+	56: "Session Report Request",
+	57: "Session Report Response",
+}
+
+var groupedIEs = map[uint16]bool{
+	1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true,
+	9: true, 10: true, 11: true, 12: true, 13: true, 14: true, 15: true,
+	16: true, 17: true, 18: true, 51: true, 54: true, 58: true, 59: true,
+	68: true, 77: true, 78: true, 79: true, 80: true, 83: true, 85: true,
+	86: true, 87: true, 99: true, 102: true, 105: true, 118: true,
+	127: true, 128: true, 129: true, 130: true, 132: true, 143: true,
+	147: true, 165: true, 166: true, 167: true, 168: true, 169: true,
+	175: true, 176: true, 183: true, 187: true, 188: true, 189: true,
+	190: true, 195: true, 199: true, 200: true, 201: true, 203: true,
+	205: true, 211: true, 212: true, 213: true, 214: true, 216: true,
+	218: true, 220: true, 221: true, 225: true, 226: true, 227: true,
+	233: true, 238: true, 239: true, 240: true, 242: true, 247: true,
+	252: true, 254: true, 255: true, 256: true, 261: true, 263: true,
+	264: true, 267: true, 270: true,
+}
+
+// MessageTree is decoded PFCP message
+type MessageTree struct {
+	Time        time.Time `json:"time"`
+	Direction   string    `json:"direction"`
+	MessageType byte      `json:"messageType"`
+	Name        string    `json:"name"`
+	SEID        string    `json:"SEID,omitempty"`
+	Sequence    uint32    `json:"sequence"`
+	IEs         []IENode  `json:"IEs,omitempty"`
+}
+
+// IENode is decoded IE
+type IENode struct {
+	Type  uint16      `json:"type"`
+	Name  string      `json:"name"`
+	Value interface{} `json:"value,omitempty"`
+	Hex   string      `json:"hex,omitempty"`
+	IEs   []IENode    `json:"IEs,omitempty"`
+}
+
+func messageName(t byte) string {
+	if n, ok := messageNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("Unknown message (%d)", t)
+}
+
+func newMessageTree(dir string, m Message) MessageTree {
+	tr := MessageTree{
+		Time:        time.Now(),
+		Direction:   dir,
+		MessageType: m.MessageType,
+		Name:        messageName(m.MessageType),
+		Sequence:    m.Sequence,
+		IEs:         newIENodes(m.IEs)}
+	if m.SessionID != 0 {
+		tr.SEID = strconv.FormatUint(m.SessionID, 16)
+	}
+	return tr
+}
+
+func newIENodes(ies []IE) []IENode {
+	ns := make([]IENode, 0, len(ies))
+	for _, ie := range ies {
+		n := IENode{
+			Type: ie.IEType,
+			Name: ieName(ie.IEType)}
+		if groupedIEs[ie.IEType] {
+			if c, e := pfcp.DecodeIEs(ie.Data); e == nil {
+				n.IEs = newIENodes(c)
+			} else {
+				n.Hex = hex.EncodeToString(ie.Data)
+			}
+		} else if v := ieValue(ie.IEType, ie.Data); v != nil {
+			n.Value = v
+		} else {
+			n.Hex = hex.EncodeToString(ie.Data)
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+// ieValue returns human readable value of the IE,
+// or nil if the IE type is unknown or the data is invalid.
+func ieValue(t uint16, d []byte) interface{} {
+	switch t {
+	case 19:
+		if len(d) != 0 {
+			return fmt.Sprintf("%d (%s)", d[0], Cause(d[0]))
+		}
+	case 20:
+		if len(d) != 0 && d[0]&0x0f < 5 {
+			return []string{"Access", "Core", "N6-LAN", "CP-function",
+				"VN-Internal"}[d[0]&0x0f]
+		}
+	case 42:
+		if len(d) != 0 && d[0]&0x0f < 6 {
+			return []string{"Access", "Core", "N6-LAN", "CP-function",
+				"LI-function", "VN-Internal"}[d[0]&0x0f]
+		}
+	case 21:
+		v := FTEID{}
+		if v.decode(d) == nil {
+			return v
+		}
+		if len(d) != 0 && d[0]&0x04 == 0x04 {
+			s := "CHOOSE"
+			if d[0]&0x01 == 0x01 {
+				s += " IPv4"
+			}
+			if d[0]&0x02 == 0x02 {
+				s += " IPv6"
+			}
+			if d[0]&0x08 == 0x08 && len(d) > 1 {
+				s += fmt.Sprintf(" (ID=%d)", d[1])
+			}
+			return s
+		}
+	case 22, 24, 91, 159:
+		return string(d)
+	case 28, 29, 56, 64, 81, 88, 104, 108, 109, 117, 124, 125, 158, 170, 173,
+		196, 197, 215, 246:
+		if len(d) != 0 && len(d) <= 8 {
+			var v uint64
+			for _, b := range d {
+				v = (v << 8) | uint64(b)
+			}
+			return v
+		}
+	case 39:
+		if len(d) != 0 {
+			fs := []string{}
+			for i, n := range []string{
+				"DLDR", "USAR", "ERIR", "UPIR", "TMIR", "SESR", "UISR"} {
+				if d[0]&(0x01<<uint(i)) != 0 {
+					fs = append(fs, n)
+				}
+			}
+			return strings.Join(fs, "|")
+		}
+	case 40:
+		if len(d) >= 2 {
+			t := binary.BigEndian.Uint16(d)
+			return fmt.Sprintf("%d (%s)", t, ieName(t))
+		}
+	case 57:
+		v := FSEID{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 60:
+		if v, e := pfcp.DecodeNodeID(d); e == nil {
+			return v
+		}
+	case 61:
+		v := PFDContents{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 63:
+		v := UsageReportTrigger{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 65:
+		v := FQCSID{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 66:
+		v := VolumeMeasurement{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 69, 70, 75, 76, 96, 156:
+		if v, e := decodeTimeStamp(d); e == nil {
+			return v
+		}
+	case 92:
+		v := FlowInformation{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 93:
+		v := UEIP{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 114:
+		v := FailedRuleID{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 141:
+		v := UserID{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 152:
+		v := TraceInformation{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 171:
+		if len(d) != 0 {
+			if v, e := SteeringFunctionality(d[0] & 0x0f).MarshalText(); e == nil {
+				return string(v)
+			}
+		}
+	case 172:
+		if len(d) != 0 {
+			if v, e := SteeringMode(d[0] & 0x0f).MarshalText(); e == nil {
+				return string(v)
+			}
+		}
+	case 174:
+		if len(d) != 0 {
+			if v, e := AccessPriority(d[0] & 0x0f).MarshalText(); e == nil {
+				return string(v)
+			}
+		}
+	case 178:
+		v := AlternativeIP{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 193:
+		v := PacketRateStatus{}
+		if v.decode(d) == nil {
+			return v
+		}
+	case 248:
+		v := QoSMonitoringMeasurement{}
+		if v.decode(d) == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// String returns text tree of the message
+func (tr MessageTree) String() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s PFCP: %s (type=%d, seq=%d",
+		tr.Direction, tr.Name, tr.MessageType, tr.Sequence)
+	if len(tr.SEID) != 0 {
+		fmt.Fprintf(buf, ", SEID=%s", tr.SEID)
+	}
+	fmt.Fprintln(buf, ")")
+	writeIENodes(buf, tr.IEs, " |")
+	return buf.String()
+}
+
+func writeIENodes(buf *bytes.Buffer, ns []IENode, indent string) {
+	for _, n := range ns {
+		switch {
+		case n.IEs != nil:
+			fmt.Fprintf(buf, "%s %s:\n", indent, n.Name)
+			writeIENodes(buf, n.IEs, indent+" |")
+		case n.Value != nil:
+			if s, ok := n.Value.(string); ok {
+				fmt.Fprintf(buf, "%s %s: %s\n", indent, n.Name, s)
+			} else if b, e := json.Marshal(n.Value); e == nil {
+				fmt.Fprintf(buf, "%s %s: %s\n", indent, n.Name, b)
+			} else {
+				fmt.Fprintf(buf, "%s %s: %v\n", indent, n.Name, n.Value)
+			}
+		default:
+			fmt.Fprintf(buf, "%s %s: 0x%s\n", indent, n.Name, n.Hex)
+		}
+	}
+}
+
+// traceMessage writes decoded message to debug log and trace file
+func traceMessage(dir string, m Message) {
+	confLock.RLock()
+	v := verbose
+	confLock.RUnlock()
+	if !v && traceFile == nil {
+		return
+	}
+	tr := newMessageTree(dir, m)
+	if v {
+		log.Print(tr.String())
+	}
+	if traceFile != nil {
+		b, _ := json.Marshal(tr)
+		traceLock.Lock()
+		traceFile.Write(append(b, '\n'))
+		traceLock.Unlock()
+	}
+}
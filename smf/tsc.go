@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// CreatedBridgeInfo is Created Bridge Info for TSC IE
+type CreatedBridgeInfo struct {
+	DSTTPort uint32 `json:"DSTTPortNumber,omitempty"`
+	BridgeID string `json:"TSNBridgeID,omitempty"`
+}
+
+func (ie *CreatedBridgeInfo) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 196:
+			if len(i.Data) < 4 {
+				e = fmt.Errorf("invalid DS-TT Port Number")
+			} else {
+				ie.DSTTPort = binary.BigEndian.Uint32(i.Data)
+			}
+		case 198:
+			if len(i.Data) < 1 {
+				e = fmt.Errorf("invalid TSN Bridge ID")
+			} else if i.Data[0]&0x01 == 0x01 {
+				if len(i.Data) < 9 {
+					e = fmt.Errorf("invalid TSN Bridge ID")
+				} else {
+					ie.BridgeID = hex.EncodeToString(i.Data[1:9])
+				}
+			}
+		}
+		if e != nil {
+			break
+		}
+	}
+	return
+}
+
+// TSCManagementInfo is TSC Management Information IE.
+// Containers are hex string of octets which is transferred transparently.
+type TSCManagementInfo struct {
+	PortManagement   string `json:"portManagementContainer,omitempty"`
+	BridgeManagement string `json:"bridgeManagementContainer,omitempty"`
+	NWTTPort         uint32 `json:"NWTTPortNumber,omitempty"`
+}
+
+func (ie TSCManagementInfo) encode(t uint16, b *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	if data, e := hex.DecodeString(ie.PortManagement); e == nil && len(data) != 0 {
+		buf.Write([]byte{0x00, 0xca, byte(len(data) >> 8), byte(len(data))})
+		buf.Write(data)
+	}
+	if data, e := hex.DecodeString(ie.BridgeManagement); e == nil && len(data) != 0 {
+		buf.Write([]byte{0x01, 0x0a, byte(len(data) >> 8), byte(len(data))})
+		buf.Write(data)
+	}
+	if ie.NWTTPort != 0 {
+		buf.Write([]byte{0x00, 0xc5, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, ie.NWTTPort)
+	}
+
+	binary.Write(b, binary.BigEndian, t)
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (ie *TSCManagementInfo) decode(b []byte) (e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return
+	}
+	for _, i := range ies {
+		switch i.IEType {
+		case 202:
+			ie.PortManagement = hex.EncodeToString(i.Data)
+		case 266:
+			ie.BridgeManagement = hex.EncodeToString(i.Data)
+		case 197:
+			if len(i.Data) < 4 {
+				return fmt.Errorf("invalid NW-TT Port Number")
+			}
+			ie.NWTTPort = binary.BigEndian.Uint32(i.Data)
+		}
+	}
+	return
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
 )
 
 // CreateURR IE
@@ -181,3 +184,304 @@ func (ie VolumeThreshold) encode(b *bytes.Buffer) {
 	data[4] = flag
 	b.Write(data)
 }
+
+// UsageReport IE
+type UsageReport struct {
+	ID           uint32             `json:"ID"`
+	Sequence     uint32             `json:"URSEQN"`
+	Trigger      UsageReportTrigger `json:"trigger"`
+	Start        *time.Time         `json:"startTime,omitempty"`
+	End          *time.Time         `json:"endTime,omitempty"`
+	Volume       *VolumeMeasurement `json:"volumeMeasurement,omitempty"`
+	Duration     uint32             `json:"durationMeasurement,omitempty"`
+	AppDetection *AppDetectionInfo  `json:"applicationDetectionInformation,omitempty"`
+	// UE IP address
+	// Network Instance
+	First       *time.Time        `json:"timeOfFirstPacket,omitempty"`
+	Last        *time.Time        `json:"timeOfLastPacket,omitempty"`
+	Info        *UsageInformation `json:"usageInformation,omitempty"`
+	QueryURRRef uint32            `json:"queryURRReference,omitempty"`
+	// Event Time Stamp
+	// Ethernet Traffic Information
+	// Join IP Muticast Information
+	// Leave IP Muticast Information
+}
+
+func (ie *UsageReport) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 81:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.ID = binary.BigEndian.Uint32(b)
+			}
+		case 104:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Sequence = binary.BigEndian.Uint32(b)
+			}
+		case 63:
+			e = ie.Trigger.decode(b)
+		case 75:
+			ie.Start, e = decodeTimeStamp(b)
+		case 76:
+			ie.End, e = decodeTimeStamp(b)
+		case 66:
+			ie.Volume = &VolumeMeasurement{}
+			e = ie.Volume.decode(b)
+		case 67:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Duration = binary.BigEndian.Uint32(b)
+			}
+		case 69:
+			ie.First, e = decodeTimeStamp(b)
+		case 70:
+			ie.Last, e = decodeTimeStamp(b)
+		case 90:
+			if len(b) < 1 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.Info = &UsageInformation{
+					BEF: b[0]&0x01 == 0x01,
+					AFT: b[0]&0x02 == 0x02,
+					UAE: b[0]&0x04 == 0x04,
+					UBE: b[0]&0x08 == 0x08}
+			}
+		case 125:
+			if len(b) < 4 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.QueryURRRef = binary.BigEndian.Uint32(b)
+			}
+		case 68:
+			ie.AppDetection = &AppDetectionInfo{}
+			e = ie.AppDetection.decode(b)
+		}
+		if e != nil {
+			break
+		}
+	}
+
+	return
+}
+
+// AppDetectionInfo is Application Detection Information IE
+type AppDetectionInfo struct {
+	ApplicationID string           `json:"applicationID"`
+	InstanceID    string           `json:"instanceID,omitempty"`
+	Flow          *FlowInformation `json:"flowInformation,omitempty"`
+	PDR           uint16           `json:"PDR,omitempty"`
+}
+
+func (ie *AppDetectionInfo) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var t, n uint16
+	var l int
+
+	for buf.Len() > 0 {
+		if e = binary.Read(buf, binary.BigEndian, &t); e != nil {
+			break
+		}
+		if e = binary.Read(buf, binary.BigEndian, &n); e != nil {
+			break
+		}
+		b = make([]byte, int(n))
+		if l, e = buf.Read(b); e != nil {
+			break
+		}
+		if l != len(b) {
+			e = io.ErrUnexpectedEOF
+			break
+		}
+
+		switch t {
+		case 24:
+			ie.ApplicationID = string(b)
+		case 91:
+			ie.InstanceID = string(b)
+		case 92:
+			ie.Flow = &FlowInformation{}
+			e = ie.Flow.decode(b)
+		case 56:
+			if len(b) < 2 {
+				e = fmt.Errorf("invalid data")
+			} else {
+				ie.PDR = binary.BigEndian.Uint16(b)
+			}
+		}
+		if e != nil {
+			break
+		}
+	}
+
+	return
+}
+
+// FlowInformation IE
+type FlowInformation struct {
+	Direction   FlowDirection `json:"direction"`
+	Description string        `json:"description"`
+}
+
+func (ie *FlowInformation) decode(b []byte) error {
+	if len(b) < 3 || len(b) < 3+int(binary.BigEndian.Uint16(b[1:])) {
+		return fmt.Errorf("invalid data")
+	}
+	ie.Direction = FlowDirection(b[0] & 0x07)
+	ie.Description = string(b[3 : 3+int(binary.BigEndian.Uint16(b[1:]))])
+	return nil
+}
+
+// FlowDirection of Flow Information IE
+type FlowDirection byte
+
+// MarshalText returns text of ie
+func (ie FlowDirection) MarshalText() ([]byte, error) {
+	switch ie {
+	case 0:
+		return []byte("Unspecified"), nil
+	case 1:
+		return []byte("Downlink"), nil
+	case 2:
+		return []byte("Uplink"), nil
+	case 3:
+		return []byte("Bidirectional"), nil
+	}
+	return nil, fmt.Errorf("invalid Flow Direction: %d", ie)
+}
+
+// UnmarshalText sets value of data to *ie.
+func (ie *FlowDirection) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "Unspecified":
+		*ie = 0
+	case "Downlink":
+		*ie = 1
+	case "Uplink":
+		*ie = 2
+	case "Bidirectional":
+		*ie = 3
+	default:
+		return fmt.Errorf("invalid Flow Direction: %s", data)
+	}
+	return nil
+}
+
+// UsageReportTrigger IE
+type UsageReportTrigger struct {
+	PERIO bool `json:"PERIO,omitempty"`
+	VOLTH bool `json:"VOLTH,omitempty"`
+	TIMTH bool `json:"TIMTH,omitempty"`
+	QUHTI bool `json:"QUHTI,omitempty"`
+	START bool `json:"START,omitempty"`
+	STOPT bool `json:"STOPT,omitempty"`
+	DROTH bool `json:"DROTH,omitempty"`
+	IMMER bool `json:"IMMER,omitempty"`
+	VOLQU bool `json:"VOLQU,omitempty"`
+	TIMQU bool `json:"TIMQU,omitempty"`
+	LIUSA bool `json:"LIUSA,omitempty"`
+	TERMR bool `json:"TERMR,omitempty"`
+	MONIT bool `json:"MONIT,omitempty"`
+	ENVCL bool `json:"ENVCL,omitempty"`
+	MACAR bool `json:"MACAR,omitempty"`
+	EVETH bool `json:"EVETH,omitempty"`
+	EVEQU bool `json:"EVEQU,omitempty"`
+	TEBUR bool `json:"TEBUR,omitempty"`
+	IPMJL bool `json:"IPMJL,omitempty"`
+	QUVTI bool `json:"QUVTI,omitempty"`
+	EMRRE bool `json:"EMRRE,omitempty"`
+	UPINT bool `json:"UPINT,omitempty"`
+}
+
+func (ie *UsageReportTrigger) decode(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("invalid data")
+	}
+	ie.PERIO = b[0]&0x01 == 0x01
+	ie.VOLTH = b[0]&0x02 == 0x02
+	ie.TIMTH = b[0]&0x04 == 0x04
+	ie.QUHTI = b[0]&0x08 == 0x08
+	ie.START = b[0]&0x10 == 0x10
+	ie.STOPT = b[0]&0x20 == 0x20
+	ie.DROTH = b[0]&0x40 == 0x40
+	ie.IMMER = b[0]&0x80 == 0x80
+	ie.VOLQU = b[1]&0x01 == 0x01
+	ie.TIMQU = b[1]&0x02 == 0x02
+	ie.LIUSA = b[1]&0x04 == 0x04
+	ie.TERMR = b[1]&0x08 == 0x08
+	ie.MONIT = b[1]&0x10 == 0x10
+	ie.ENVCL = b[1]&0x20 == 0x20
+	ie.MACAR = b[1]&0x40 == 0x40
+	ie.EVETH = b[1]&0x80 == 0x80
+	if len(b) > 2 {
+		ie.EVEQU = b[2]&0x01 == 0x01
+		ie.TEBUR = b[2]&0x02 == 0x02
+		ie.IPMJL = b[2]&0x04 == 0x04
+		ie.QUVTI = b[2]&0x08 == 0x08
+		ie.EMRRE = b[2]&0x10 == 0x10
+		ie.UPINT = b[2]&0x20 == 0x20
+	}
+	return nil
+}
+
+// VolumeMeasurement IE
+type VolumeMeasurement struct {
+	Total           *uint64 `json:"total,omitempty"`
+	Uplink          *uint64 `json:"uplink,omitempty"`
+	Downlink        *uint64 `json:"downlink,omitempty"`
+	TotalPackets    *uint64 `json:"totalPackets,omitempty"`
+	UplinkPackets   *uint64 `json:"uplinkPackets,omitempty"`
+	DownlinkPackets *uint64 `json:"downlinkPackets,omitempty"`
+}
+
+func (ie *VolumeMeasurement) decode(b []byte) (e error) {
+	buf := bytes.NewReader(b)
+	var flag byte
+
+	if flag, e = buf.ReadByte(); e != nil {
+		return
+	}
+	for i, v := range []**uint64{
+		&ie.Total, &ie.Uplink, &ie.Downlink,
+		&ie.TotalPackets, &ie.UplinkPackets, &ie.DownlinkPackets} {
+		if flag&(0x01<<uint(i)) == 0x00 {
+			continue
+		}
+		*v = new(uint64)
+		if e = binary.Read(buf, binary.BigEndian, *v); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// UsageInformation IE
+type UsageInformation struct {
+	BEF bool `json:"BEF,omitempty"`
+	AFT bool `json:"AFT,omitempty"`
+	UAE bool `json:"UAE,omitempty"`
+	UBE bool `json:"UBE,omitempty"`
+}
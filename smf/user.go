@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+)
+
+// UserID IE, IMSI, IMEI and MSISDN are digit strings
+type UserID struct {
+	IMSI   string `json:"IMSI,omitempty"`
+	IMEI   string `json:"IMEI,omitempty"`
+	MSISDN string `json:"MSISDN,omitempty"`
+	NAI    string `json:"NAI,omitempty"`
+	SUPI   string `json:"SUPI,omitempty"`
+	GPSI   string `json:"GPSI,omitempty"`
+}
+
+func (ie UserID) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer([]byte{0x00})
+	for i, v := range []string{ie.IMSI, ie.IMEI, ie.MSISDN} {
+		if len(v) != 0 {
+			buf.Bytes()[0] |= 0x01 << uint(i)
+			data := encodeTBCD(v)
+			buf.WriteByte(byte(len(data)))
+			buf.Write(data)
+		}
+	}
+	for i, v := range []string{ie.NAI, ie.SUPI, ie.GPSI} {
+		if len(v) != 0 {
+			buf.Bytes()[0] |= 0x08 << uint(i)
+			buf.WriteByte(byte(len(v)))
+			buf.WriteString(v)
+		}
+	}
+
+	b.Write([]byte{0x00, 0x8d})
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (ie *UserID) decode(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("invalid data")
+	}
+	f := b[0]
+	b = b[1:]
+	for i, v := range []*string{
+		&ie.IMSI, &ie.IMEI, &ie.MSISDN, &ie.NAI, &ie.SUPI, &ie.GPSI} {
+		if f&(0x01<<uint(i)) == 0 {
+			continue
+		}
+		if len(b) < 1 || len(b) < int(b[0])+1 {
+			return fmt.Errorf("invalid data")
+		}
+		l := int(b[0])
+		if i < 3 {
+			*v = decodeTBCD(b[1 : l+1])
+		} else {
+			*v = string(b[1 : l+1])
+		}
+		b = b[l+1:]
+	}
+	return nil
+}
+
+func encodeTBCD(s string) []byte {
+	b := make([]byte, (len(s)+1)/2)
+	for i, c := range s {
+		d := byte(c-'0') & 0x0f
+		if i%2 == 0 {
+			b[i/2] = 0xf0 | d
+		} else {
+			b[i/2] = b[i/2]&0x0f | d<<4
+		}
+	}
+	return b
+}
+
+func decodeTBCD(b []byte) string {
+	s := make([]byte, 0, len(b)*2)
+	for _, o := range b {
+		for _, d := range []byte{o & 0x0f, o >> 4} {
+			if d > 9 {
+				return string(s)
+			}
+			s = append(s, '0'+d)
+		}
+	}
+	return string(s)
+}
+
+// TraceInformation IE.
+// Trace reference is MCC, MNC and TraceID, TraceID is hex string of 3 octets.
+// TriggeringEvents and Interfaces are hex string of octets.
+type TraceInformation struct {
+	MCC              string `json:"MCC"`
+	MNC              string `json:"MNC"`
+	TraceID          string `json:"traceID"`
+	TriggeringEvents string `json:"triggeringEvents,omitempty"`
+	Depth            byte   `json:"sessionTraceDepth"`
+	Interfaces       string `json:"interfaces,omitempty"`
+	Collector        net.IP `json:"collectionEntity"`
+}
+
+func (ie TraceInformation) encode(b *bytes.Buffer) {
+	buf := bytes.NewBuffer(encodePLMN(ie.MCC, ie.MNC))
+
+	id, _ := hex.DecodeString(ie.TraceID)
+	buf.Write(append(make([]byte, 3), id...)[len(id):])
+	data, _ := hex.DecodeString(ie.TriggeringEvents)
+	buf.WriteByte(byte(len(data)))
+	buf.Write(data)
+	buf.WriteByte(ie.Depth)
+	data, _ = hex.DecodeString(ie.Interfaces)
+	buf.WriteByte(byte(len(data)))
+	buf.Write(data)
+	if ip := ie.Collector.To4(); ip != nil {
+		buf.WriteByte(4)
+		buf.Write(ip)
+	} else if ip = ie.Collector.To16(); ip != nil {
+		buf.WriteByte(16)
+		buf.Write(ip)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	b.Write([]byte{0x00, 0x98})
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (ie *TraceInformation) decode(b []byte) error {
+	if len(b) < 7 {
+		return fmt.Errorf("invalid data")
+	}
+	ie.MCC, ie.MNC = decodePLMN(b)
+	ie.TraceID = hex.EncodeToString(b[3:6])
+	b = b[6:]
+	for i, v := range []*string{&ie.TriggeringEvents, &ie.Interfaces} {
+		if len(b) < 1 || len(b) < int(b[0])+2 {
+			return fmt.Errorf("invalid data")
+		}
+		l := int(b[0])
+		*v = hex.EncodeToString(b[1 : l+1])
+		b = b[l+1:]
+		if i == 0 {
+			ie.Depth = b[0]
+			b = b[1:]
+		}
+	}
+	if l := int(b[0]); l > len(b)-1 {
+		return fmt.Errorf("invalid data")
+	} else if l != 0 {
+		ie.Collector = net.IP(b[1 : l+1])
+	}
+	return nil
+}
+
+// encodePLMN returns MCC and MNC in TBCD, digit 3 of MNC is filler if len(mnc) is 2
+func encodePLMN(mcc, mnc string) []byte {
+	d := [6]byte{}
+	for i := range d {
+		d[i] = 0x0f
+	}
+	for i := 0; i < len(mcc) && i < 3; i++ {
+		d[i] = mcc[i] - '0'
+	}
+	for i := 0; i < len(mnc) && i < 3; i++ {
+		d[i+3] = mnc[i] - '0'
+	}
+	return []byte{d[1]<<4 | d[0], d[5]<<4 | d[2], d[4]<<4 | d[3]}
+}
+
+func decodePLMN(b []byte) (mcc, mnc string) {
+	mcc = decodeTBCD([]byte{b[0], b[1]&0x0f | 0xf0})
+	mnc = decodeTBCD([]byte{b[2], b[1]>>4 | 0xf0})
+	return
+}
+
+// encodeRDS writes Provide RDS configuration information IE
+// with RDS configuration information IE
+func encodeRDS(b *bytes.Buffer) {
+	b.Write([]byte{0x01, 0x05, 0x00, 0x05, 0x01, 0x06, 0x00, 0x01, 0x01})
+}
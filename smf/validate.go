@@ -0,0 +1,526 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// validation is skipped if query parameter "validate=false" is specified,
+// for sending invalid message to peer intentionally.
+func needValidation(r *http.Request) bool {
+	return r.URL.Query().Get("validate") != "false"
+}
+
+func (d EstablishmentRequest) validate() (ps []InvalidParam) {
+	if len(d.PDR) == 0 {
+		ps = append(ps, InvalidParam{
+			Param: "/PDR", Reason: "at least one PDR is required"})
+	}
+	if len(d.FAR) == 0 {
+		ps = append(ps, InvalidParam{
+			Param: "/FAR", Reason: "at least one FAR is required"})
+	}
+
+	if d.UserID != nil {
+		ps = append(ps, d.UserID.validate("/userID")...)
+	}
+	if d.Trace != nil {
+		ps = append(ps, d.Trace.validate("/trace")...)
+	}
+
+	s := newRuleSet()
+	ps = append(ps, dupIDs("/PDR", "PDR", pdrIDs(d.PDR), s.pdr)...)
+	ps = append(ps, dupIDs("/FAR", "FAR", farIDs(d.FAR), s.far)...)
+	ps = append(ps, dupIDs("/URR", "URR", urrIDs(d.URR), s.urr)...)
+	ps = append(ps, dupIDs("/QER", "QER", qerIDs(d.QER), s.qer)...)
+	ps = append(ps, dupIDs("/MAR", "MAR", marIDs(d.MAR), s.mar)...)
+	ps = append(ps, dupIDs("/SRR", "SRR", srrIDs(d.SRR), s.srr)...)
+
+	for i, p := range d.PDR {
+		ps = append(ps, s.validateRef(fmt.Sprintf("/PDR/%d", i), p.FAR, p.URR, p.QER)...)
+		ps = append(ps, s.validateMARRef(fmt.Sprintf("/PDR/%d", i), p.MAR)...)
+		ps = append(ps, p.PDI.validate(fmt.Sprintf("/PDR/%d/PDI", i))...)
+	}
+	for i, p := range d.FAR {
+		if p.Forwarding != nil && p.Forwarding.Header != nil {
+			ps = append(ps, p.Forwarding.Header.validate(
+				fmt.Sprintf("/FAR/%d/forwardingParam/header", i))...)
+		}
+		if p.Redundant != nil {
+			ps = append(ps, p.Redundant.Header.validate(
+				fmt.Sprintf("/FAR/%d/redundant/header", i))...)
+		}
+		if p.BAR != 0 && (d.BAR == nil || d.BAR.ID != p.BAR) {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/FAR/%d/BAR", i),
+				Reason: fmt.Sprintf("undefined BAR ID %d", p.BAR)})
+		}
+	}
+	for i, p := range d.QER {
+		ps = append(ps, validateQoS(fmt.Sprintf("/QER/%d", i), p.QFI, p.PPI)...)
+	}
+	for i, p := range d.MAR {
+		ps = append(ps, s.validateAccess(fmt.Sprintf("/MAR/%d", i),
+			p.Access3GPP, p.AccessNon3GPP)...)
+	}
+	for i, p := range d.SRR {
+		ps = append(ps, validateQoSMonitoring(
+			fmt.Sprintf("/SRR/%d", i), p.QoSMonitoring)...)
+	}
+	return
+}
+
+func (d ModificationRequest) validate(t *session) (ps []InvalidParam) {
+	s := t.rules.clone()
+	for _, p := range d.RemovePDR {
+		delete(s.pdr, uint32(p.ID))
+	}
+	for _, p := range d.RemoveFAR {
+		delete(s.far, p.ID)
+	}
+	for _, p := range d.RemoveURR {
+		delete(s.urr, p.ID)
+	}
+	for _, p := range d.RemoveQER {
+		delete(s.qer, p.ID)
+	}
+	for _, p := range d.RemoveMAR {
+		delete(s.mar, uint32(p.ID))
+	}
+	for _, p := range d.RemoveSRR {
+		delete(s.srr, uint32(p.ID))
+	}
+
+	ps = append(ps, dupIDs("/createPDR", "PDR", pdrIDs(d.CreatePDR), s.pdr)...)
+	ps = append(ps, dupIDs("/createFAR", "FAR", farIDs(d.CreateFAR), s.far)...)
+	ps = append(ps, dupIDs("/createURR", "URR", urrIDs(d.CreateURR), s.urr)...)
+	ps = append(ps, dupIDs("/createQER", "QER", qerIDs(d.CreateQER), s.qer)...)
+	ps = append(ps, dupIDs("/createMAR", "MAR", marIDs(d.CreateMAR), s.mar)...)
+	ps = append(ps, dupIDs("/createSRR", "SRR", srrIDs(d.CreateSRR), s.srr)...)
+
+	for i, p := range d.UpdatePDR {
+		if !s.pdr[uint32(p.ID)] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updatePDR/%d/ID", i),
+				Reason: fmt.Sprintf("undefined PDR ID %d", p.ID)})
+		}
+	}
+	for i, p := range d.UpdateFAR {
+		if !s.far[p.ID] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updateFAR/%d/ID", i),
+				Reason: fmt.Sprintf("undefined FAR ID %d", p.ID)})
+		}
+	}
+	for i, p := range d.UpdateURR {
+		if !s.urr[p.ID] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updateURR/%d/ID", i),
+				Reason: fmt.Sprintf("undefined URR ID %d", p.ID)})
+		}
+	}
+	for i, p := range d.UpdateQER {
+		if !s.qer[p.ID] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updateQER/%d/ID", i),
+				Reason: fmt.Sprintf("undefined QER ID %d", p.ID)})
+		}
+	}
+	for i, p := range d.UpdateMAR {
+		if !s.mar[uint32(p.ID)] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updateMAR/%d/ID", i),
+				Reason: fmt.Sprintf("undefined MAR ID %d", p.ID)})
+		}
+	}
+	for i, p := range d.UpdateSRR {
+		if !s.srr[uint32(p.ID)] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("/updateSRR/%d/ID", i),
+				Reason: fmt.Sprintf("undefined SRR ID %d", p.ID)})
+		}
+	}
+
+	for i, p := range d.CreatePDR {
+		ps = append(ps, s.validateRef(fmt.Sprintf("/createPDR/%d", i), p.FAR, p.URR, p.QER)...)
+		ps = append(ps, s.validateMARRef(fmt.Sprintf("/createPDR/%d", i), p.MAR)...)
+		ps = append(ps, p.PDI.validate(fmt.Sprintf("/createPDR/%d/PDI", i))...)
+	}
+	for i, p := range d.UpdatePDR {
+		ps = append(ps, s.validateRef(fmt.Sprintf("/updatePDR/%d", i), p.FAR, p.URR, p.QER)...)
+		if p.PDI != nil {
+			ps = append(ps, p.PDI.validate(fmt.Sprintf("/updatePDR/%d/PDI", i))...)
+		}
+	}
+	for i, p := range d.CreateFAR {
+		if p.Forwarding != nil && p.Forwarding.Header != nil {
+			ps = append(ps, p.Forwarding.Header.validate(
+				fmt.Sprintf("/createFAR/%d/forwardingParam/header", i))...)
+		}
+		if p.Redundant != nil {
+			ps = append(ps, p.Redundant.Header.validate(
+				fmt.Sprintf("/createFAR/%d/redundant/header", i))...)
+		}
+	}
+	for i, p := range d.UpdateFAR {
+		if p.Forwarding != nil && p.Forwarding.Header != nil {
+			ps = append(ps, p.Forwarding.Header.validate(
+				fmt.Sprintf("/updateFAR/%d/forwardingParam/header", i))...)
+		}
+		if p.Redundant != nil {
+			ps = append(ps, p.Redundant.Header.validate(
+				fmt.Sprintf("/updateFAR/%d/redundant/header", i))...)
+		}
+	}
+	for i, p := range d.CreateQER {
+		ps = append(ps, validateQoS(fmt.Sprintf("/createQER/%d", i), p.QFI, p.PPI)...)
+	}
+	for i, p := range d.UpdateQER {
+		ps = append(ps, validateQoS(fmt.Sprintf("/updateQER/%d", i), p.QFI, p.PPI)...)
+	}
+	if d.TSC != nil {
+		ps = append(ps, d.TSC.validate("/TSC")...)
+	}
+	for i, p := range d.CreateMAR {
+		ps = append(ps, s.validateAccess(fmt.Sprintf("/createMAR/%d", i),
+			p.Access3GPP, p.AccessNon3GPP)...)
+	}
+	for i, p := range d.UpdateMAR {
+		ps = append(ps, s.validateAccess(fmt.Sprintf("/updateMAR/%d", i),
+			p.Access3GPP, p.AccessNon3GPP)...)
+		if p.UpdateAccess3GPP != nil {
+			ps = append(ps, s.validateRef(fmt.Sprintf("/updateMAR/%d/update3GPPAccess", i),
+				p.UpdateAccess3GPP.FAR, p.UpdateAccess3GPP.URR, nil)...)
+		}
+		if p.UpdateAccessNon3GPP != nil {
+			ps = append(ps, s.validateRef(fmt.Sprintf("/updateMAR/%d/updateNon3GPPAccess", i),
+				p.UpdateAccessNon3GPP.FAR, p.UpdateAccessNon3GPP.URR, nil)...)
+		}
+	}
+	for i, p := range d.CreateSRR {
+		ps = append(ps, validateQoSMonitoring(
+			fmt.Sprintf("/createSRR/%d", i), p.QoSMonitoring)...)
+	}
+	for i, p := range d.UpdateSRR {
+		ps = append(ps, validateQoSMonitoring(
+			fmt.Sprintf("/updateSRR/%d", i), p.QoSMonitoring)...)
+	}
+	return
+}
+
+func (s ruleSet) validateRef(path string, far uint32, urr, qer []uint32) (ps []InvalidParam) {
+	if far != 0 && !s.far[far] {
+		ps = append(ps, InvalidParam{
+			Param:  path + "/FAR",
+			Reason: fmt.Sprintf("undefined FAR ID %d", far)})
+	}
+	for i, id := range urr {
+		if !s.urr[id] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("%s/URR/%d", path, i),
+				Reason: fmt.Sprintf("undefined URR ID %d", id)})
+		}
+	}
+	for i, id := range qer {
+		if !s.qer[id] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("%s/QER/%d", path, i),
+				Reason: fmt.Sprintf("undefined QER ID %d", id)})
+		}
+	}
+	return
+}
+
+func (s ruleSet) validateMARRef(path string, mar uint16) (ps []InvalidParam) {
+	if mar != 0 && !s.mar[uint32(mar)] {
+		ps = append(ps, InvalidParam{
+			Param:  path + "/MAR",
+			Reason: fmt.Sprintf("undefined MAR ID %d", mar)})
+	}
+	return
+}
+
+// validateAccess checks 3GPP and non-3GPP access forwarding action
+// information, FAR is mandatory for creating them
+func (s ruleSet) validateAccess(path string, a3gpp, an3gpp *AccessForwarding) (ps []InvalidParam) {
+	for _, a := range []struct {
+		path string
+		ie   *AccessForwarding
+	}{{path + "/3GPPAccess", a3gpp}, {path + "/non3GPPAccess", an3gpp}} {
+		if a.ie == nil {
+			continue
+		}
+		if a.ie.FAR == 0 {
+			ps = append(ps, InvalidParam{
+				Param: a.path + "/FAR", Reason: "FAR is required"})
+		}
+		ps = append(ps, s.validateRef(a.path, a.ie.FAR, a.ie.URR, nil)...)
+	}
+	return
+}
+
+func (p PDI) validate(path string) (ps []InvalidParam) {
+	if p.Interface == 0 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/interface", Reason: "source interface is required"})
+	}
+	if p.FTEID != nil && p.FTEID.IPv4 == nil && p.FTEID.IPv6 == nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/FTEID", Reason: "no IPv4 or IPv6 address"})
+	}
+	if p.Redundant != nil && p.Redundant.FTEID.IPv4 == nil && p.Redundant.FTEID.IPv6 == nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/redundant/FTEID", Reason: "no IPv4 or IPv6 address"})
+	}
+	if p.QFI > 63 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/QFI", Reason: fmt.Sprintf("QFI %d exceeds 63", p.QFI)})
+	}
+	return
+}
+
+func (ie HeaderCreation) validate(path string) (ps []InvalidParam) {
+	if (ie.ID != 0 || ie.Port != 0) && ie.IPv4 == nil && ie.IPv6 == nil {
+		ps = append(ps, InvalidParam{
+			Param: path, Reason: "no IPv4 or IPv6 address"})
+	} else if ie.IPv4 == nil && ie.IPv6 == nil && ie.CTag == 0 && ie.STag == 0 {
+		ps = append(ps, InvalidParam{
+			Param: path, Reason: "no outer header"})
+	}
+	return
+}
+
+func (d ApplicationPFDs) validate(path string) (ps []InvalidParam) {
+	if len(d.ApplicationID) == 0 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/applicationID", Reason: "application ID is required"})
+	}
+	for i, c := range d.PFDContext {
+		if len(c.Contents) == 0 {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("%s/PFDContext/%d", path, i),
+				Reason: "at least one PFD contents is required"})
+		}
+		for j, p := range c.Contents {
+			if len(p.FlowDescription) == 0 && len(p.URL) == 0 &&
+				len(p.DomainName) == 0 && len(p.CustomPFD) == 0 &&
+				len(p.AdditionalFlows) == 0 && len(p.AdditionalURLs) == 0 {
+				ps = append(ps, InvalidParam{
+					Param:  fmt.Sprintf("%s/PFDContext/%d/contents/%d", path, i, j),
+					Reason: "no flow description, URL, domain name or custom PFD"})
+			}
+		}
+	}
+	return
+}
+
+func (ie TSCManagementInfo) validate(path string) (ps []InvalidParam) {
+	if _, e := hex.DecodeString(ie.PortManagement); e != nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/portManagementContainer", Reason: e.Error()})
+	}
+	if _, e := hex.DecodeString(ie.BridgeManagement); e != nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/bridgeManagementContainer", Reason: e.Error()})
+	}
+	return
+}
+
+func (ie UserID) validate(path string) (ps []InvalidParam) {
+	ns := []string{"IMSI", "IMEI", "MSISDN", "NAI", "SUPI", "GPSI"}
+	for i, v := range []string{
+		ie.IMSI, ie.IMEI, ie.MSISDN, ie.NAI, ie.SUPI, ie.GPSI} {
+		if i < 3 && !isDigits(v) {
+			ps = append(ps, InvalidParam{
+				Param: path + "/" + ns[i], Reason: "not a digit string"})
+		} else if len(v) > 255 || i < 3 && len(v) > 30 {
+			ps = append(ps, InvalidParam{
+				Param: path + "/" + ns[i], Reason: "too long"})
+		}
+	}
+	return
+}
+
+func (ie TraceInformation) validate(path string) (ps []InvalidParam) {
+	if len(ie.MCC) != 3 || !isDigits(ie.MCC) {
+		ps = append(ps, InvalidParam{
+			Param: path + "/MCC", Reason: "MCC must be 3 digits"})
+	}
+	if len(ie.MNC) < 2 || len(ie.MNC) > 3 || !isDigits(ie.MNC) {
+		ps = append(ps, InvalidParam{
+			Param: path + "/MNC", Reason: "MNC must be 2 or 3 digits"})
+	}
+	if id, e := hex.DecodeString(ie.TraceID); e != nil || len(id) != 3 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/traceID", Reason: "trace ID must be 3 octets"})
+	}
+	if _, e := hex.DecodeString(ie.TriggeringEvents); e != nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/triggeringEvents", Reason: e.Error()})
+	}
+	if _, e := hex.DecodeString(ie.Interfaces); e != nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/interfaces", Reason: e.Error()})
+	}
+	if ie.Collector == nil {
+		ps = append(ps, InvalidParam{
+			Param: path + "/collectionEntity", Reason: "IP address is required"})
+	}
+	return
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validateQoSMonitoring(path string, cs []QoSMonitoringControl) (ps []InvalidParam) {
+	for i, c := range cs {
+		p := fmt.Sprintf("%s/QoSMonitoring/%d", path, i)
+		if len(c.QFI) == 0 {
+			ps = append(ps, InvalidParam{
+				Param: p + "/QFI", Reason: "at least one QFI is required"})
+		}
+		for j, qfi := range c.QFI {
+			if qfi < 0 || qfi > 63 {
+				ps = append(ps, InvalidParam{
+					Param:  fmt.Sprintf("%s/QFI/%d", p, j),
+					Reason: fmt.Sprintf("QFI %d is out of range", qfi)})
+			}
+		}
+		if c.Frequency.PERIO && c.MeasurementPeriod == 0 {
+			ps = append(ps, InvalidParam{
+				Param:  p + "/measurementPeriod",
+				Reason: "measurement period is required for periodic reporting"})
+		}
+		if c.Frequency.EVETT && c.Thresholds == nil {
+			ps = append(ps, InvalidParam{
+				Param:  p + "/packetDelayThresholds",
+				Reason: "packet delay thresholds are required for event triggered reporting"})
+		}
+	}
+	return
+}
+
+func validateQoS(path string, qfi, ppi byte) (ps []InvalidParam) {
+	if qfi > 63 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/QFI", Reason: fmt.Sprintf("QFI %d is out of range", qfi)})
+	}
+	if ppi > 7 {
+		ps = append(ps, InvalidParam{
+			Param: path + "/PPI", Reason: fmt.Sprintf("PPI %d exceeds 7", ppi)})
+	}
+	return
+}
+
+// ruleSet is IDs of rules in the session
+type ruleSet struct {
+	pdr map[uint32]bool
+	far map[uint32]bool
+	urr map[uint32]bool
+	qer map[uint32]bool
+	mar map[uint32]bool
+	srr map[uint32]bool
+}
+
+func newRuleSet() ruleSet {
+	return ruleSet{
+		pdr: make(map[uint32]bool),
+		far: make(map[uint32]bool),
+		urr: make(map[uint32]bool),
+		qer: make(map[uint32]bool),
+		mar: make(map[uint32]bool),
+		srr: make(map[uint32]bool)}
+}
+
+func (s ruleSet) clone() ruleSet {
+	c := newRuleSet()
+	for k := range s.pdr {
+		c.pdr[k] = true
+	}
+	for k := range s.far {
+		c.far[k] = true
+	}
+	for k := range s.urr {
+		c.urr[k] = true
+	}
+	for k := range s.qer {
+		c.qer[k] = true
+	}
+	for k := range s.mar {
+		c.mar[k] = true
+	}
+	for k := range s.srr {
+		c.srr[k] = true
+	}
+	return c
+}
+
+// dupIDs returns invalid parameters of ids which are duplicated in ids
+// or already in used, ids are added to used.
+// path is path of the rule list and kind is name of the rule.
+func dupIDs(path, kind string, ids []uint32, used map[uint32]bool) (ps []InvalidParam) {
+	for i, id := range ids {
+		if used[id] {
+			ps = append(ps, InvalidParam{
+				Param:  fmt.Sprintf("%s/%d/ID", path, i),
+				Reason: fmt.Sprintf("duplicated %s ID %d", kind, id)})
+		}
+		used[id] = true
+	}
+	return
+}
+
+func pdrIDs(r []CreatePDR) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = uint32(p.ID)
+	}
+	return ids
+}
+
+func farIDs(r []CreateFAR) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func urrIDs(r []CreateURR) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func qerIDs(r []CreateQER) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func marIDs(r []CreateMAR) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = uint32(p.ID)
+	}
+	return ids
+}
+
+func srrIDs(r []CreateSRR) []uint32 {
+	ids := make([]uint32, len(r))
+	for i, p := range r {
+		ids[i] = uint32(p.ID)
+	}
+	return ids
+}
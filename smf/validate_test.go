@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkDuplicated compares duplicated ID errors in ps with exp
+func checkDuplicated(t *testing.T, ps, exp []InvalidParam) {
+	var dup []InvalidParam
+	for _, p := range ps {
+		if strings.HasPrefix(p.Reason, "duplicated ") {
+			dup = append(dup, p)
+		}
+	}
+	if len(dup) != len(exp) {
+		t.Fatalf("duplicated IDs are %+v, expected %+v", dup, exp)
+	}
+	for i := range exp {
+		if dup[i] != exp[i] {
+			t.Errorf("duplicated ID #%d is %+v, expected %+v", i, dup[i], exp[i])
+		}
+	}
+}
+
+func TestDuplicatedIDs(t *testing.T) {
+	checkDuplicated(t, EstablishmentRequest{
+		PDR: []CreatePDR{{ID: 1, FAR: 1}, {ID: 1, FAR: 1}},
+		FAR: []CreateFAR{{ID: 1}},
+		SRR: []CreateSRR{{ID: 2}, {ID: 3}, {ID: 2}}}.validate(),
+		[]InvalidParam{
+			{Param: "/PDR/1/ID", Reason: "duplicated PDR ID 1"},
+			{Param: "/SRR/2/ID", Reason: "duplicated SRR ID 2"}})
+
+	s := &session{rules: newRuleSet()}
+	s.rules.pdr[1] = true
+	s.rules.far[1] = true
+	s.rules.mar[5] = true
+	checkDuplicated(t, ModificationRequest{
+		RemoveFAR: []RemoveFAR{{ID: 1}},
+		CreatePDR: []CreatePDR{{ID: 1}},
+		CreateFAR: []CreateFAR{{ID: 1}},
+		CreateMAR: []CreateMAR{{ID: 5}}}.validate(s),
+		[]InvalidParam{
+			{Param: "/createPDR/0/ID", Reason: "duplicated PDR ID 1"},
+			{Param: "/createMAR/0/ID", Reason: "duplicated MAR ID 5"}})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+
+	"github.com/fkgi/harico/gtpu"
+)
+
+var (
+	gtp gtpu.Handler
+	n6  *os.File // tun device of N6, ICMP echo is answered if nil
+
+	maxBuffer = 128
+)
+
+func readN6() {
+	b := make([]byte, 1500)
+	for {
+		n, e := n6.Read(b)
+		if e != nil {
+			log.Println("N6 device is closed:", e)
+			break
+		}
+		p := make([]byte, n)
+		copy(p, b[:n])
+
+		lock.Lock()
+		downlink(p)
+		lock.Unlock()
+	}
+}
+
+func uplink(teid uint32, peer *net.UDPAddr, qfi byte, seq int, pdu []byte) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	t, ok := teids[teid]
+	if !ok {
+		log.Printf("GTP-U: unknown TEID %d from %s", teid, peer)
+		return
+	}
+	var p *PDR
+	for _, r := range t.PDR {
+		if r.Source != 0 || r.TEID != teid && r.RedundantTEID != teid ||
+			r.QFI != 0 && qfi < 64 && r.QFI != qfi {
+			continue
+		}
+		if p == nil || r.Precedence < p.Precedence {
+			p = r
+		}
+	}
+	if p == nil {
+		log.Printf("GTP-U: no PDR matches TEID %d", teid)
+		return
+	}
+	if p.elim != nil && seq >= 0 && p.elim.Duplicated(uint16(seq)) {
+		return
+	}
+	for _, id := range p.URR {
+		if u, ok := t.URR[id]; ok {
+			u.Uplink += uint64(len(pdu))
+			u.ULPackets++
+		}
+	}
+
+	f, ok := t.FAR[p.FAR]
+	if !ok || f.Action&actFORW == 0 {
+		return
+	}
+	if n6 != nil {
+		if _, e := n6.Write(pdu); e != nil {
+			log.Println("N6: failed to write:", e)
+		}
+	} else if r := echoReply(pdu); r != nil {
+		downlink(r)
+	}
+}
+
+// downlink forwards the packet to UE, lock must be held
+func downlink(pkt []byte) {
+	var dst net.IP
+	switch {
+	case len(pkt) >= 20 && pkt[0]>>4 == 4:
+		dst = net.IP(pkt[16:20])
+	case len(pkt) >= 40 && pkt[0]>>4 == 6:
+		dst = net.IP(pkt[24:40])
+	default:
+		return
+	}
+	t, ok := ueips[dst.String()]
+	if !ok {
+		return
+	}
+	var p *PDR
+	for _, r := range t.PDR {
+		if r.Source != 1 || !r.UEIP.Equal(dst) {
+			continue
+		}
+		if p == nil || r.Precedence < p.Precedence {
+			p = r
+		}
+	}
+	if p == nil {
+		return
+	}
+	for _, id := range p.URR {
+		if u, ok := t.URR[id]; ok {
+			u.Downlink += uint64(len(pkt))
+			u.DLPackets++
+		}
+	}
+
+	f, ok := t.FAR[p.FAR]
+	switch {
+	case !ok || f.Action&actDROP != 0:
+	case f.Action&actBUFF != 0:
+		if len(t.buffer[f.ID]) < maxBuffer {
+			t.buffer[f.ID] = append(t.buffer[f.ID], pkt)
+		}
+		if f.Action&actNOCP != 0 && !t.notify {
+			t.notify = true
+			go t.sendReport(ReportRequest{DLDR: true, PDR: p.ID})
+		}
+	case f.Action&actFORW != 0:
+		t.send(f, p, pkt)
+	}
+}
+
+// flush sends buffered packets of the FAR, lock must be held
+func (t *session) flush(id uint32) {
+	f, ok := t.FAR[id]
+	if !ok || f.Action&actFORW == 0 || len(t.buffer[id]) == 0 {
+		return
+	}
+	var p *PDR
+	for _, r := range t.PDR {
+		if r.FAR == id {
+			p = r
+			break
+		}
+	}
+	for _, pkt := range t.buffer[id] {
+		t.send(f, p, pkt)
+	}
+	delete(t.buffer, id)
+}
+
+func (t *session) send(f *FAR, p *PDR, pkt []byte) {
+	if f.IP == nil {
+		return
+	}
+	var qfi byte = 255
+	if p != nil {
+		for _, id := range p.QER {
+			if q, ok := t.QER[id]; ok && q.QFI != 0 {
+				qfi = q.QFI
+				break
+			}
+		}
+	}
+	if f.RedundantIP != nil {
+		if e := gtp.SendRedundant([2]uint32{f.TEID, f.RedundantTEID}, [2]*net.UDPAddr{
+			{IP: f.IP, Port: 2152}, {IP: f.RedundantIP, Port: 2152}}, qfi, pkt); e != nil {
+			log.Println("GTP-U: failed to send:", e)
+		}
+		return
+	}
+	if e := gtp.Send(f.TEID, &net.UDPAddr{IP: f.IP, Port: 2152}, qfi, pkt); e != nil {
+		log.Println("GTP-U: failed to send:", e)
+	}
+}
+
+// echoReply returns ICMP echo reply of the IPv4 echo request
+func echoReply(pkt []byte) []byte {
+	if len(pkt) < 20 || pkt[0]>>4 != 4 || pkt[9] != 1 {
+		return nil
+	}
+	hl := int(pkt[0]&0x0f) * 4
+	l := int(binary.BigEndian.Uint16(pkt[2:]))
+	if l > len(pkt) || hl+8 > l || pkt[hl] != 8 {
+		return nil
+	}
+
+	r := make([]byte, l)
+	copy(r, pkt)
+	copy(r[12:16], pkt[16:20])
+	copy(r[16:20], pkt[12:16])
+	r[8] = 64
+	r[10], r[11] = 0, 0
+	binary.BigEndian.PutUint16(r[10:], checksum(r[:hl]))
+	r[hl] = 0
+	r[hl+2], r[hl+3] = 0, 0
+	binary.BigEndian.PutUint16(r[hl+2:], checksum(r[hl:]))
+	return r
+}
+
+func checksum(b []byte) uint16 {
+	var s uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	return ^uint16(s)
+}
+
+// ReportRequest triggers Session Report Request
+type ReportRequest struct {
+	DLDR bool     `json:"DLDR,omitempty"`
+	USAR bool     `json:"USAR,omitempty"`
+	ERIR bool     `json:"ERIR,omitempty"`
+	UPIR bool     `json:"UPIR,omitempty"`
+	TMIR bool     `json:"TMIR,omitempty"`
+	SESR bool     `json:"SESR,omitempty"`
+	PDR  uint16   `json:"PDR,omitempty"`
+	URR  []uint32 `json:"URR,omitempty"`
+	// RemoteTEID and RemoteIP are F-TEID of Error Indication Report
+	RemoteTEID uint32 `json:"remoteTEID,omitempty"`
+	RemoteIP   net.IP `json:"remoteIP,omitempty"`
+	// Application is detected application of START/STOP usage report
+	Application *AppDetection `json:"application,omitempty"`
+	// TSC is TSC Management Information of TMIR report
+	TSC *TSCManagement `json:"TSC,omitempty"`
+	// QoSMonitoring is measurement of SESR report
+	QoSMonitoring *QoSMonitoring `json:"QoSMonitoring,omitempty"`
+}
+
+// AppDetection is Application Detection Information
+type AppDetection struct {
+	ID        string `json:"ID"`
+	Instance  string `json:"instance,omitempty"`
+	Flow      string `json:"flowDescription,omitempty"`
+	Direction byte   `json:"direction,omitempty"`
+	PDR       uint16 `json:"PDR,omitempty"`
+	Stop      bool   `json:"stop,omitempty"`
+}
+
+func (a AppDetection) encode() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0x00, 0x18})
+	binary.Write(buf, binary.BigEndian, uint16(len(a.ID)))
+	buf.WriteString(a.ID)
+	if len(a.Instance) != 0 {
+		buf.Write([]byte{0x00, 0x5b})
+		binary.Write(buf, binary.BigEndian, uint16(len(a.Instance)))
+		buf.WriteString(a.Instance)
+	}
+	if len(a.Flow) != 0 {
+		buf.Write([]byte{0x00, 0x5c})
+		binary.Write(buf, binary.BigEndian, uint16(len(a.Flow)+3))
+		buf.WriteByte(a.Direction & 0x07)
+		binary.Write(buf, binary.BigEndian, uint16(len(a.Flow)))
+		buf.WriteString(a.Flow)
+	}
+	if a.PDR != 0 {
+		buf.Write([]byte{0x00, 0x38, 0x00, 0x02})
+		binary.Write(buf, binary.BigEndian, a.PDR)
+	}
+
+	b := bytes.NewBuffer([]byte{0x00, 0x44})
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+	return b.Bytes()
+}
+
+// ReportResult is response of Session Report Request
+type ReportResult struct {
+	Cause byte `json:"cause"`
+}
+
+func (t *session) sendReport(r ReportRequest) (ReportResult, error) {
+	buf := new(bytes.Buffer)
+	var f byte
+	if r.DLDR {
+		f = f | 0x01
+	}
+	if r.USAR {
+		f = f | 0x02
+	}
+	if r.ERIR {
+		f = f | 0x04
+	}
+	if r.UPIR {
+		f = f | 0x08
+	}
+	if r.TMIR {
+		f = f | 0x10
+	}
+	if r.SESR {
+		f = f | 0x20
+	}
+	buf.Write([]byte{0x00, 0x27, 0x00, 0x01, f})
+
+	if r.DLDR {
+		buf.Write([]byte{0x00, 0x53, 0x00, 0x06, 0x00, 0x38, 0x00, 0x02})
+		binary.Write(buf, binary.BigEndian, r.PDR)
+	}
+	if r.USAR {
+		lock.Lock()
+		ids := r.URR
+		if len(ids) == 0 {
+			ids = t.urrIDs()
+		}
+		trigger, adi := []byte{0x80, 0x00, 0x00}, []byte(nil)
+		if a := r.Application; a != nil && a.Stop {
+			trigger, adi = []byte{0x20, 0x00, 0x00}, a.encode()
+		} else if a != nil {
+			trigger, adi = []byte{0x10, 0x00, 0x00}, a.encode()
+		}
+		for _, id := range ids {
+			if u, ok := t.URR[id]; ok {
+				u.report(80, trigger, adi, buf)
+			}
+		}
+		lock.Unlock()
+	}
+	if r.ERIR {
+		if ip := r.RemoteIP.To4(); ip != nil {
+			buf.Write([]byte{0x00, 0x63, 0x00, 0x0d, 0x00, 0x15, 0x00, 0x09, 0x01})
+			binary.Write(buf, binary.BigEndian, r.RemoteTEID)
+			buf.Write(ip)
+		} else if ip = r.RemoteIP.To16(); ip != nil {
+			buf.Write([]byte{0x00, 0x63, 0x00, 0x19, 0x00, 0x15, 0x00, 0x15, 0x02})
+			binary.Write(buf, binary.BigEndian, r.RemoteTEID)
+			buf.Write(ip)
+		}
+	}
+
+	if r.TMIR && r.TSC != nil {
+		r.TSC.encode(201, buf)
+	}
+	if q := r.QoSMonitoring; r.SESR && q != nil {
+		lock.Lock()
+		if s, ok := t.SRR[q.SRR]; ok {
+			q.report(s, buf)
+		}
+		lock.Unlock()
+	}
+
+	m, e := writeRequest(t.peer, 56, t.CPSEID, func(b *bytes.Buffer) {
+		buf.WriteTo(b)
+	})
+	if e != nil {
+		log.Printf("Tx PFCP: session report failed: %s", e)
+		return ReportResult{}, e
+	}
+	res := ReportResult{}
+	for _, ie := range m.IEs {
+		if ie.IEType == 19 && len(ie.Data) != 0 {
+			res.Cause = ie.Data[0]
+		}
+	}
+	return res, nil
+}
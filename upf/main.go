@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fkgi/harico/gtpu"
+	"github.com/fkgi/harico/pcap"
+)
+
+func main() {
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	log.Println("starting HARICO UPF")
+
+	la := flag.String("l", "127.0.0.1:8805", "PFCP local addr/port")
+	ga := flag.String("g", "127.0.0.3:2152", "GTP-U local addr/port")
+	up := flag.String("u", "10.60.0.0/16", "UE IP address pool")
+	n := flag.String("n", "", "N6 tun device, ICMP echo is answered if empty")
+	mg := flag.String("m", ":8082", "management API addr/port")
+	pc := flag.String("p", "", "pcap (not pcapng) file of GTP-U packets")
+	d := flag.String("d", "", "IP address of other family for dual-stack F-SEID")
+	flag.Parse()
+
+	rand.Seed(time.Now().UnixNano())
+
+	var e error
+	if gtpAddr, e = net.ResolveUDPAddr("udp", *ga); e != nil {
+		log.Fatalln("invalid GTP-U address:", e)
+	}
+	if _, uePool, e = net.ParseCIDR(*up); e != nil {
+		log.Fatalln("invalid UE IP address pool:", e)
+	}
+	if len(*d) != 0 {
+		if dualStack = net.ParseIP(*d); dualStack == nil {
+			log.Fatalln("invalid dual-stack address:", *d)
+		}
+	}
+	if len(*pc) != 0 {
+		w, e := pcap.Create(*pc)
+		if e != nil {
+			log.Fatalln("failed to create pcap file:", e)
+		}
+		defer w.Close()
+		gtpu.Capture = w
+	}
+	if len(*n) != 0 {
+		if n6, e = gtpu.OpenTun(*n); e != nil {
+			log.Fatalln("failed to open N6 device:", e)
+		}
+		defer n6.Close()
+		go readN6()
+	}
+
+	gtpu.Receive = uplink
+	if gtp, e = gtpu.StartHandler(*ga); e != nil {
+		log.Fatalln("GTP local binding failed:", e)
+	}
+	if e = listenPFCP(*la); e != nil {
+		log.Fatalln("PFCP local binding failed:", e)
+	}
+	if ip := n4Addr(); dualStack != nil &&
+		(dualStack.To4() != nil) == (ip.To4() != nil) {
+		log.Fatalf("dual-stack address %s is the same family as N4 address %s",
+			dualStack, ip)
+	}
+
+	go func() {
+		log.Fatalln(http.ListenAndServe(*mg, http.Handler(apiHandler)))
+	}()
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	<-sigc
+	log.Println("shutting down")
+	con.Close()
+	gtp.Close()
+
+	log.Println("process is stopped")
+}
+
+var apiHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf, "Rx API:")
+	fmt.Fprintln(buf, " | method: ", r.Method)
+	fmt.Fprintln(buf, " | authority: ", r.URL.String())
+	if r.Body != nil {
+		b, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if len(b) != 0 {
+			fmt.Fprintln(buf, " | body:")
+			for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				fmt.Fprintln(buf, " | |", l)
+			}
+		}
+	}
+	log.Print(buf.String())
+
+	p := r.URL.Path
+	if p == "" {
+		p = "/"
+	} else {
+		if p[0] != '/' {
+			p = "/" + p
+		}
+		np := path.Clean(p)
+		if p[len(p)-1] == '/' && np != "/" {
+			if len(p) == len(np)+1 && strings.HasPrefix(p, np) {
+				np = p
+			} else {
+				np += "/"
+			}
+		}
+		p = np
+	}
+
+	if b, _ := path.Match("/pfcp-up/v1/session", p); b {
+		switch r.Method {
+		case http.MethodGet:
+			handleSessionList(w, r)
+		default:
+			w.Header().Set("allow", "GET")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only GET is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-up/v1/pfd", p); b {
+		switch r.Method {
+		case http.MethodGet:
+			handlePFDList(w, r)
+		default:
+			w.Header().Set("allow", "GET")
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid method",
+				Status:   http.StatusMethodNotAllowed,
+				Detail:   "only GET is allowed",
+				Instance: r.URL.Path})
+		}
+	} else if b, _ := path.Match("/pfcp-up/v1/session/*", p); b {
+		if t, ok := lookupSession(w, r, strings.Split(p, "/")[4]); ok {
+			switch r.Method {
+			case http.MethodGet:
+				handleSessionGET(w, r, t)
+			default:
+				w.Header().Set("allow", "GET")
+				errorResponse(w, ProblemDetails{
+					Title:    "invalid method",
+					Status:   http.StatusMethodNotAllowed,
+					Detail:   "only GET is allowed",
+					Instance: r.URL.Path})
+			}
+		}
+	} else if b, _ := path.Match("/pfcp-up/v1/session/*/report", p); b {
+		if t, ok := lookupSession(w, r, strings.Split(p, "/")[4]); ok {
+			switch r.Method {
+			case http.MethodPost:
+				handleReportPOST(w, r, t)
+			default:
+				w.Header().Set("allow", "POST")
+				errorResponse(w, ProblemDetails{
+					Title:    "invalid method",
+					Status:   http.StatusMethodNotAllowed,
+					Detail:   "only POST is allowed",
+					Instance: r.URL.Path})
+			}
+		}
+	} else {
+		errorResponse(w, ProblemDetails{
+			Title:    "context not found",
+			Status:   http.StatusNotFound,
+			Detail:   "invalid path",
+			Instance: r.URL.Path})
+	}
+})
+
+func lookupSession(w http.ResponseWriter, r *http.Request, s string) (*session, bool) {
+	id, e := strconv.ParseUint(s, 16, 64)
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "context not found",
+			Status:   http.StatusNotFound,
+			Detail:   "invalid session ID",
+			Instance: r.URL.Path})
+		return nil, false
+	}
+	lock.Lock()
+	t, ok := sessions[id]
+	lock.Unlock()
+	if !ok {
+		errorResponse(w, ProblemDetails{
+			Title:    "context not found",
+			Status:   http.StatusNotFound,
+			Detail:   "no such session",
+			Instance: r.URL.Path})
+	}
+	return t, ok
+}
+
+func handleSessionList(w http.ResponseWriter, r *http.Request) {
+	lock.Lock()
+	l := make([]string, 0, len(sessions))
+	for id := range sessions {
+		l = append(l, strconv.FormatUint(id, 16))
+	}
+	lock.Unlock()
+
+	b, _ := json.Marshal(l)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handleSessionGET(w http.ResponseWriter, r *http.Request, t *session) {
+	lock.Lock()
+	t.Buffer = 0
+	for _, b := range t.buffer {
+		t.Buffer += len(b)
+	}
+	b, _ := json.Marshal(t)
+	lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func handleReportPOST(w http.ResponseWriter, r *http.Request, t *session) {
+	d := ReportRequest{}
+	b, e := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "reading HTTP BODY failed",
+			Status:   http.StatusInternalServerError,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if e = json.Unmarshal(b, &d); e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "unmarshal JSON failed",
+			Status:   http.StatusBadRequest,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+	if d.Application != nil {
+		d.USAR = true
+	}
+	if d.TSC != nil {
+		if e = d.TSC.validate(); e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid report",
+				Status:   http.StatusBadRequest,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+			return
+		}
+		d.TMIR = true
+	}
+	if d.QoSMonitoring != nil {
+		lock.Lock()
+		e = d.QoSMonitoring.validate(t)
+		lock.Unlock()
+		if e != nil {
+			errorResponse(w, ProblemDetails{
+				Title:    "invalid report",
+				Status:   http.StatusBadRequest,
+				Detail:   e.Error(),
+				Instance: r.URL.Path})
+			return
+		}
+		d.SESR = true
+	}
+	if !d.DLDR && !d.USAR && !d.ERIR && !d.UPIR && !d.TMIR && !d.SESR {
+		errorResponse(w, ProblemDetails{
+			Title:    "invalid report",
+			Status:   http.StatusBadRequest,
+			Detail:   "no report type",
+			Instance: r.URL.Path})
+		return
+	}
+
+	res, e := t.sendReport(d)
+	if e != nil {
+		errorResponse(w, ProblemDetails{
+			Title:    "PFCP message handling failed",
+			Status:   http.StatusGatewayTimeout,
+			Detail:   e.Error(),
+			Instance: r.URL.Path})
+		return
+	}
+
+	b, _ = json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func errorResponse(w http.ResponseWriter, p ProblemDetails) {
+	w.Header().Set("content-type", "application/problem+json")
+	b, _ := json.Marshal(p)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+// ProblemDetails struct
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// MAR of UPF
+type MAR struct {
+	ID            uint16 `json:"ID"`
+	Functionality byte   `json:"steeringFunctionality"`
+	Mode          byte   `json:"steeringMode"`
+	FAR3GPP       uint32 `json:"3GPPAccessFAR,omitempty"`
+	FARNon3GPP    uint32 `json:"non3GPPAccessFAR,omitempty"`
+}
+
+// MPTCP proxy port which is returned in ATSSS Control Parameters
+const mptcpPort = 8001
+
+func (t *session) applyMAR(typ uint16, b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	var r *MAR
+	for _, ie := range ies {
+		if ie.IEType == 170 && len(ie.Data) >= 2 {
+			id := binary.BigEndian.Uint16(ie.Data)
+			if o, ok := t.MAR[id]; ok {
+				r = o
+			} else if typ == 165 {
+				r = &MAR{ID: id}
+			} else {
+				return unknownRule("MAR", uint32(id))
+			}
+		}
+	}
+	if r == nil {
+		return ruleError{cause: 66, ieType: 170, msg: "MAR ID is missing"}
+	}
+
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 171:
+			if len(ie.Data) != 0 {
+				r.Functionality = ie.Data[0] & 0x0f
+			}
+		case 172:
+			if len(ie.Data) != 0 {
+				r.Mode = ie.Data[0] & 0x0f
+			}
+		case 166, 175:
+			if id, e := ruleID(ie.Data, 108); e == nil {
+				r.FAR3GPP = id
+			} else if ie.IEType == 166 {
+				return e
+			}
+		case 167, 176:
+			if id, e := ruleID(ie.Data, 108); e == nil {
+				r.FARNon3GPP = id
+			} else if ie.IEType == 167 {
+				return e
+			}
+		}
+	}
+	t.MAR[r.ID] = r
+	return nil
+}
+
+func (t *session) removeMAR(b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	for _, ie := range ies {
+		if ie.IEType != 170 || len(ie.Data) < 2 {
+			continue
+		}
+		id := binary.BigEndian.Uint16(ie.Data)
+		if _, ok := t.MAR[id]; !ok {
+			return unknownRule("MAR", uint32(id))
+		}
+		delete(t.MAR, id)
+		return nil
+	}
+	return ruleError{cause: 66, ieType: 170, msg: "MAR ID is missing"}
+}
+
+// checkMAR verifies that FARs referred from MARs and MARs referred from PDRs exist
+func (t *session) checkMAR() error {
+	for _, r := range t.MAR {
+		for _, id := range []uint32{r.FAR3GPP, r.FARNon3GPP} {
+			if _, ok := t.FAR[id]; !ok && id != 0 {
+				return ruleError{cause: 73, ieType: 108,
+					msg: fmt.Sprintf("unknown FAR %d in MAR %d", id, r.ID)}
+			}
+		}
+	}
+	for _, p := range t.PDR {
+		if _, ok := t.MAR[p.MAR]; !ok && p.MAR != 0 {
+			return ruleError{cause: 73, ieType: 170,
+				msg: fmt.Sprintf("unknown MAR %d in PDR %d", p.MAR, p.ID)}
+		}
+	}
+	return nil
+}
+
+// atsssParameters writes ATSSS Control Parameters IE
+// if Provide ATSSS Control Information IE is in ies
+func atsssParameters(ies []IE, b *bytes.Buffer) {
+	for _, ie := range ies {
+		if ie.IEType != 220 {
+			continue
+		}
+		c, e := pfcp.DecodeIEs(ie.Data)
+		if e != nil {
+			return
+		}
+		buf := new(bytes.Buffer)
+		for _, i := range c {
+			if len(i.Data) == 0 || i.Data[0]&0x01 == 0 {
+				continue
+			}
+			switch i.IEType {
+			case 222:
+				// MPTCP Address Information of the proxy on N3 address
+				info := new(bytes.Buffer)
+				if ip := gtpAddr.IP.To4(); ip != nil {
+					info.Write([]byte{0x01, 0x01})
+					binary.Write(info, binary.BigEndian, uint16(mptcpPort))
+					info.Write(ip)
+				} else {
+					info.Write([]byte{0x02, 0x01})
+					binary.Write(info, binary.BigEndian, uint16(mptcpPort))
+					info.Write(gtpAddr.IP.To16())
+				}
+				buf.Write([]byte{0x00, 0xe1})
+				binary.Write(buf, binary.BigEndian, uint16(info.Len()+4))
+				buf.Write([]byte{0x00, 0xe4})
+				binary.Write(buf, binary.BigEndian, uint16(info.Len()))
+				info.WriteTo(buf)
+			case 223:
+				buf.Write([]byte{0x00, 0xe2, 0x00, 0x05,
+					0x00, 0xe7, 0x00, 0x01, 0x01})
+			case 224:
+				// PMF Address Information with N3 address and ports
+				info := new(bytes.Buffer)
+				if ip := gtpAddr.IP.To4(); ip != nil {
+					info.WriteByte(0x01)
+					info.Write(ip)
+				} else {
+					info.WriteByte(0x02)
+					info.Write(gtpAddr.IP.To16())
+				}
+				binary.Write(info, binary.BigEndian, uint16(mptcpPort+1))
+				binary.Write(info, binary.BigEndian, uint16(mptcpPort+2))
+				buf.Write([]byte{0x00, 0xe3})
+				binary.Write(buf, binary.BigEndian, uint16(info.Len()+4))
+				buf.Write([]byte{0x00, 0xe6})
+				binary.Write(buf, binary.BigEndian, uint16(info.Len()))
+				info.WriteTo(buf)
+			}
+		}
+		b.Write([]byte{0x00, 0xdd})
+		binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+		buf.WriteTo(b)
+		return
+	}
+}
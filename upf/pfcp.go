@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+var (
+	con     *net.UDPConn
+	peers   = make(map[string]bool) // associated peers by Node ID
+	seq     = make(chan uint32, 1)
+	txStack = make(map[uint32]chan Message)
+	lock    sync.Mutex
+
+	recovery = time.Now()
+	waitTime = time.Second * 3
+)
+
+// Message of PFCP with the peer address
+type Message struct {
+	pfcp.Message
+	peer *net.UDPAddr
+}
+
+// IE of PFCP
+type IE = pfcp.IE
+
+func listenPFCP(laddr string) (e error) {
+	var la *net.UDPAddr
+	if la, e = net.ResolveUDPAddr("udp", laddr); e != nil {
+		return
+	}
+	if con, e = net.ListenUDP("udp", la); e != nil {
+		return
+	}
+	seq <- 0
+
+	go readMessage()
+	return
+}
+
+func readMessage() {
+	data := make([]byte, 65536)
+
+	for {
+		l, a, e := con.ReadFromUDP(data)
+		if e != nil {
+			break
+		}
+
+		p, e := pfcp.Parse(data[:l])
+		if e != nil {
+			log.Printf("Rx PFCP: %s", e)
+			continue
+		}
+		m := Message{Message: p, peer: a}
+
+		switch m.MessageType {
+		case 1:
+			log.Printf("Rx PFCP: heartbeat request")
+			writeResponse(m, 2, nil, func(b *bytes.Buffer) {
+				recoveryTimeStamp(b)
+			})
+		case 3:
+			log.Printf("Rx PFCP: PFD management request")
+			handlePFDManagement(m)
+		case 5:
+			log.Printf("Rx PFCP: association setup request")
+			n := peerNode(m)
+			if len(n) == 0 {
+				writeResponse(m, 6, nil, func(b *bytes.Buffer) {
+					nodeID(b)
+					encodeCause(66, b)
+					recoveryTimeStamp(b)
+					b.Write([]byte{0x00, 0x28, 0x00, 0x02, 0x00, 0x3c})
+				})
+				continue
+			}
+			log.Printf("Rx PFCP: association with %s", n)
+			lock.Lock()
+			peers[n] = true
+			lock.Unlock()
+			writeResponse(m, 6, nil, func(b *bytes.Buffer) {
+				nodeID(b)
+				encodeCause(1, b)
+				recoveryTimeStamp(b)
+			})
+		case 9:
+			log.Printf("Rx PFCP: association release request")
+			n := peerNode(m)
+			lock.Lock()
+			delete(peers, n)
+			releaseSessions(n)
+			lock.Unlock()
+			writeResponse(m, 10, nil, func(b *bytes.Buffer) {
+				nodeID(b)
+				encodeCause(1, b)
+			})
+		case 14:
+			log.Printf("Rx PFCP: session set deletion request")
+			handleSetDeletion(m)
+		case 16:
+			log.Printf("Rx PFCP: session set modification request")
+			handleSetModification(m)
+		case 50:
+			log.Printf("Rx PFCP: session establishment request")
+			handleEstablishment(m)
+		case 52:
+			log.Printf("Rx PFCP: session modification request")
+			handleModification(m)
+		case 54:
+			log.Printf("Rx PFCP: session deletion request")
+			handleDeletion(m)
+		case 2, 57:
+			log.Printf("Rx PFCP: response")
+			lock.Lock()
+			ch, ok := txStack[m.Sequence]
+			lock.Unlock()
+			if ok {
+				ch <- m
+			}
+		default:
+			log.Printf("Rx PFCP: unsupported message type: %d", m.MessageType)
+		}
+	}
+}
+
+// writeResponse writes response of the request m.
+// The message has session ID if seid is not nil.
+func writeResponse(m Message, t byte, seid *uint64, ies func(*bytes.Buffer)) {
+	buf := bytes.NewBuffer([]byte{0x20, t, 0x00, 0x00})
+	if seid != nil {
+		buf.Bytes()[0] = 0x21
+		binary.Write(buf, binary.BigEndian, *seid)
+	}
+	buf.Write([]byte{
+		byte(m.Sequence >> 16), byte(m.Sequence >> 8), byte(m.Sequence), 0x00})
+	ies(buf)
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+
+	if _, e := con.WriteToUDP(data, m.peer); e != nil {
+		log.Printf("Tx PFCP: failed to write: %s", e)
+	}
+}
+
+// writeRequest writes session related request to the peer
+// and waits response
+func writeRequest(peer *net.UDPAddr, t byte, seid uint64, ies func(*bytes.Buffer)) (Message, error) {
+	q := <-seq
+	seq <- q + 1
+
+	buf := bytes.NewBuffer([]byte{0x21, t, 0x00, 0x00})
+	binary.Write(buf, binary.BigEndian, seid)
+	buf.Write([]byte{byte(q >> 16), byte(q >> 8), byte(q), 0x00})
+	ies(buf)
+
+	data := buf.Bytes()
+	l := len(data) - 4
+	data[2] = byte(l >> 8)
+	data[3] = byte(l)
+
+	ch := make(chan Message, 1)
+	lock.Lock()
+	txStack[q] = ch
+	lock.Unlock()
+	defer func() {
+		lock.Lock()
+		delete(txStack, q)
+		lock.Unlock()
+	}()
+
+	log.Printf("Tx PFCP: request")
+	if _, e := con.WriteToUDP(data, peer); e != nil {
+		log.Printf("Tx PFCP: failed to write: %s", e)
+		return Message{}, e
+	}
+
+	select {
+	case m := <-ch:
+		if m.MessageType != t+1 {
+			return m, fmt.Errorf("invalid message (type=%d) from peer", m.MessageType)
+		}
+		return m, nil
+	case <-time.After(waitTime):
+		return Message{}, fmt.Errorf("request timeout")
+	}
+}
+
+func nodeID(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x3c})
+
+	if addr, ok := con.LocalAddr().(*net.UDPAddr); !ok {
+		b.Write([]byte{0x00, 0x00})
+	} else if ip := addr.IP.To4(); ip != nil {
+		b.Write([]byte{0x00, 0x05, 0x00})
+		b.Write(ip)
+	} else if ip = addr.IP.To16(); ip != nil {
+		b.Write([]byte{0x00, 0x11, 0x01})
+		b.Write(ip)
+	} else {
+		b.Write([]byte{0x00, 0x00})
+	}
+}
+
+// n4Addr returns local address of N4,
+// or GTP-U address if N4 is bound to unspecified address.
+func n4Addr() net.IP {
+	if addr, ok := con.LocalAddr().(*net.UDPAddr); ok && !addr.IP.IsUnspecified() {
+		return addr.IP
+	}
+	return gtpAddr.IP
+}
+
+// sessionID writes UP F-SEID with N4 address and dual-stack address
+func sessionID(b *bytes.Buffer, id uint64) {
+	var ip4, ip6 net.IP
+	for _, a := range []net.IP{n4Addr(), dualStack} {
+		if a.To4() != nil {
+			ip4 = a.To4()
+		} else if a.To16() != nil {
+			ip6 = a.To16()
+		}
+	}
+
+	var flag byte
+	if ip4 != nil {
+		flag |= 0x02
+	}
+	if ip6 != nil {
+		flag |= 0x01
+	}
+	b.Write([]byte{0x00, 0x39})
+	binary.Write(b, binary.BigEndian, uint16(9+len(ip4)+len(ip6)))
+	b.WriteByte(flag)
+	binary.Write(b, binary.BigEndian, id)
+	b.Write(ip4)
+	b.Write(ip6)
+}
+
+// peerNode returns Node ID in the message m, or empty if not found
+func peerNode(m Message) string {
+	for _, ie := range m.IEs {
+		if ie.IEType != 60 {
+			continue
+		}
+		if n, e := pfcp.DecodeNodeID(ie.Data); e == nil {
+			return n
+		}
+	}
+	return ""
+}
+
+func recoveryTimeStamp(b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x60, 0x00, 0x04})
+	encodeTime(recovery, b)
+}
+
+func encodeCause(c byte, b *bytes.Buffer) {
+	b.Write([]byte{0x00, 0x13, 0x00, 0x01, c})
+}
+
+func encodeTime(t time.Time, b *bytes.Buffer) {
+	d := t.Sub(time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC))
+	binary.Write(b, binary.BigEndian, uint32(d/time.Second))
+}
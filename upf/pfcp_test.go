@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+func TestPeerNodeFQDN(t *testing.T) {
+	m := Message{Message: pfcp.Message{IEs: []IE{{IEType: 60,
+		Data: []byte{0x02, 0x03, 'u', 'p', 'f', 0x04, 't', 'e', 's', 't'}}}}}
+	if n := peerNode(m); n != "upf.test" {
+		t.Errorf("peer node is %q, expected upf.test", n)
+	}
+
+	// label length 255 must not wrap around, and is longer than 63
+	m.IEs[0].Data = append([]byte{0x02, 0xff}, make([]byte, 300)...)
+	if n := peerNode(m); n != "" {
+		t.Errorf("peer node %q for too long label", n)
+	}
+	m.IEs[0].Data = append([]byte{0x02, 0x40}, make([]byte, 64)...)
+	if n := peerNode(m); n != "" {
+		t.Errorf("peer node %q for 64 octets label", n)
+	}
+	m.IEs[0].Data = append([]byte{0x02, 0xff}, make([]byte, 100)...)
+	if n := peerNode(m); len(n) != 0 {
+		t.Errorf("peer node %q for truncated FQDN", n)
+	}
+}
+
+// request sends PFCP request on c and returns the response
+func request(t *testing.T, c *net.UDPConn, typ byte, seid *uint64, ies []byte) pfcp.Message {
+	buf := bytes.NewBuffer([]byte{0x20, typ, 0x00, 0x00})
+	if seid != nil {
+		buf.Bytes()[0] = 0x21
+		binary.Write(buf, binary.BigEndian, *seid)
+	}
+	buf.Write([]byte{0x00, 0x00, 0x01, 0x00})
+	buf.Write(ies)
+	b := buf.Bytes()
+	binary.BigEndian.PutUint16(b[2:], uint16(len(b)-4))
+	if _, e := c.Write(b); e != nil {
+		t.Fatal(e)
+	}
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	b = make([]byte, 65536)
+	n, e := c.Read(b)
+	if e != nil {
+		t.Fatal(e)
+	}
+	m, e := pfcp.Parse(b[:n])
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, ie := range m.IEs {
+		if ie.IEType == 19 && (len(ie.Data) == 0 || ie.Data[0] != 1) {
+			t.Fatalf("request %d is rejected: % x", typ, ie.Data)
+		}
+	}
+	return m
+}
+
+func TestIPv6EstablishmentOnLoopback(t *testing.T) {
+	if e := listenPFCP("[::1]:0"); e != nil {
+		t.Skip("IPv6 loopback is not available:", e)
+	}
+	defer con.Close()
+	gtpAddr = &net.UDPAddr{IP: net.ParseIP("127.0.0.3"), Port: 2152}
+	// dualStack is kept after the test, PFCP reader may still read it
+	dualStack = net.ParseIP("127.0.0.1")
+
+	c, e := net.DialUDP("udp", nil, con.LocalAddr().(*net.UDPAddr))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer c.Close()
+
+	node := append([]byte{0x00, 0x3c, 0x00, 0x11, 0x01}, net.IPv6loopback...)
+	request(t, c, 5, nil, append(node, 0x00, 0x60, 0x00, 0x04, 0, 0, 0, 0))
+
+	cp := []byte{0x00, 0x39, 0x00, 0x19, 0x01, 0, 0, 0, 0, 0, 0, 0, 0x01}
+	cp = append(cp, net.IPv6loopback...)
+	zero := uint64(0)
+	m := request(t, c, 50, &zero, append(node, cp...))
+	if m.SessionID != 1 {
+		t.Errorf("SEID of response is %d, expected 1", m.SessionID)
+	}
+
+	var up []byte
+	for _, ie := range m.IEs {
+		if ie.IEType == 57 {
+			up = ie.Data
+		}
+	}
+	if len(up) != 29 || up[0] != 0x03 {
+		t.Fatalf("UP F-SEID is not dual-stack: % x", up)
+	}
+	if ip := net.IP(up[9:13]); !ip.Equal(dualStack) {
+		t.Errorf("IPv4 of UP F-SEID is %s, expected %s", ip, dualStack)
+	}
+	if ip := net.IP(up[13:29]); !ip.Equal(net.IPv6loopback) {
+		t.Errorf("IPv6 of UP F-SEID is %s, expected ::1", ip)
+	}
+}
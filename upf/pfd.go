@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// PFDs of applications, key is Application ID
+var pfds = make(map[string]*PFD)
+
+// PFD is packet flow descriptions of an application
+type PFD struct {
+	FlowDescriptions []string `json:"flowDescriptions,omitempty"`
+	URLs             []string `json:"URLs,omitempty"`
+	DomainNames      []string `json:"domainNames,omitempty"`
+}
+
+func handlePFDManagement(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	ps := make(map[string]*PFD)
+	for _, ie := range m.IEs {
+		if ie.IEType != 58 {
+			continue
+		}
+		id, p, e := decodeApplicationPFDs(ie.Data)
+		if e != nil {
+			log.Printf("Rx PFCP: PFD management failed: %s", e)
+			re, _ := e.(ruleError)
+			writeResponse(m, 4, nil, func(b *bytes.Buffer) {
+				encodeCause(re.cause, b)
+				b.Write([]byte{0x00, 0x28, 0x00, 0x02})
+				binary.Write(b, binary.BigEndian, re.ieType)
+				nodeID(b)
+			})
+			return
+		}
+		ps[id] = p
+	}
+
+	for id, p := range ps {
+		if p == nil {
+			delete(pfds, id)
+		} else {
+			pfds[id] = p
+		}
+	}
+	writeResponse(m, 4, nil, func(b *bytes.Buffer) {
+		encodeCause(1, b)
+		nodeID(b)
+	})
+}
+
+// decodeApplicationPFDs returns nil PFD if no PFD context is included
+func decodeApplicationPFDs(b []byte) (id string, p *PFD, e error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return "", nil, ruleError{cause: 69, ieType: 58, msg: e.Error()}
+	}
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 24:
+			id = string(ie.Data)
+		case 59:
+			if p == nil {
+				p = &PFD{}
+			}
+			var cs []IE
+			if cs, e = pfcp.DecodeIEs(ie.Data); e != nil {
+				return "", nil, ruleError{cause: 69, ieType: 59, msg: e.Error()}
+			}
+			for _, c := range cs {
+				if c.IEType == 61 && p.add(c.Data) != nil {
+					return "", nil, ruleError{cause: 69, ieType: 61,
+						msg: "invalid PFD contents"}
+				}
+			}
+		}
+	}
+	if len(id) == 0 {
+		e = ruleError{cause: 66, ieType: 24, msg: "application ID is missing"}
+	}
+	return
+}
+
+// add appends flow description, URL and domain name in PFD contents IE
+func (p *PFD) add(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("too short data")
+	}
+	flag := b[0]
+	b = b[2:]
+	for i := uint(0); i < 8; i++ {
+		if flag&(0x01<<i) == 0 {
+			continue
+		}
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			return fmt.Errorf("too short data")
+		}
+		v := b[2 : 2+int(binary.BigEndian.Uint16(b))]
+		b = b[2+len(v):]
+
+		switch i {
+		case 0:
+			p.FlowDescriptions = append(p.FlowDescriptions, string(v))
+		case 1:
+			p.URLs = append(p.URLs, string(v))
+		case 2:
+			p.DomainNames = append(p.DomainNames, string(v))
+		case 5, 6:
+			for len(v) >= 2 && len(v) >= 2+int(binary.BigEndian.Uint16(v)) {
+				s := string(v[2 : 2+int(binary.BigEndian.Uint16(v))])
+				v = v[2+len(s):]
+				if i == 5 {
+					p.FlowDescriptions = append(p.FlowDescriptions, s)
+				} else {
+					p.URLs = append(p.URLs, s)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func handlePFDList(w http.ResponseWriter, r *http.Request) {
+	lock.Lock()
+	b, _ := json.Marshal(pfds)
+	lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
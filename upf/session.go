@@ -0,0 +1,856 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fkgi/harico/gtpu"
+	"github.com/fkgi/harico/pfcp"
+)
+
+var (
+	sessions = make(map[uint64]*session) // key = local SEID
+	teids    = make(map[uint32]*session)
+	ueips    = make(map[string]*session)
+
+	gtpAddr   *net.UDPAddr
+	uePool    *net.IPNet
+	dualStack net.IP // address of other family for dual-stack F-SEID
+)
+
+type session struct {
+	ID       string          `json:"ID"`
+	SEID     uint64          `json:"-"`
+	CPSEID   uint64          `json:"-"`
+	Peer     string          `json:"peer"`
+	PDR      map[uint16]*PDR `json:"PDR"`
+	FAR      map[uint32]*FAR `json:"FAR"`
+	URR      map[uint32]*URR `json:"URR"`
+	QER      map[uint32]*QER `json:"QER"`
+	MAR      map[uint16]*MAR `json:"MAR,omitempty"`
+	SRR      map[byte]*SRR   `json:"SRR,omitempty"`
+	Buffer   int             `json:"bufferedPackets"`
+	CSID     []uint16        `json:"CSID,omitempty"` // SMF FQ-CSID
+	DSTTPort uint32          `json:"DSTTPortNumber,omitempty"`
+	UserID   *UserID         `json:"userID,omitempty"`
+	Trace    string          `json:"traceReference,omitempty"`
+	csidNode string
+	choose   map[byte]uint32 // CHOOSE ID to local TEID
+	buffer   map[uint32][][]byte
+	peer     *net.UDPAddr
+	notify   bool
+}
+
+// PDR of UPF
+type PDR struct {
+	ID         uint16 `json:"ID"`
+	Precedence uint32 `json:"precedence"`
+	Source     byte   `json:"sourceInterface"`
+	TEID       uint32 `json:"TEID,omitempty"`
+	// RedundantTEID is local TEID for redundant transmission
+	RedundantTEID uint32   `json:"redundantTEID,omitempty"`
+	UEIP          net.IP   `json:"UEIP,omitempty"`
+	QFI           byte     `json:"QFI,omitempty"`
+	AppID         string   `json:"applicationID,omitempty"`
+	Removal       bool     `json:"headerRemoval,omitempty"`
+	FAR           uint32   `json:"FAR,omitempty"`
+	URR           []uint32 `json:"URR,omitempty"`
+	QER           []uint32 `json:"QER,omitempty"`
+	MAR           uint16   `json:"MAR,omitempty"`
+	created       bool
+	elim          *gtpu.Eliminator // duplicate elimination of redundant transmission
+}
+
+// FAR of UPF
+type FAR struct {
+	ID     uint32 `json:"ID"`
+	Action byte   `json:"action"`
+	Dest   byte   `json:"destinationInterface"`
+	TEID   uint32 `json:"TEID,omitempty"`
+	IP     net.IP `json:"IP,omitempty"`
+	// RedundantTEID and RedundantIP are for redundant transmission
+	RedundantTEID uint32 `json:"redundantTEID,omitempty"`
+	RedundantIP   net.IP `json:"redundantIP,omitempty"`
+}
+
+// FAR Apply Action flags
+const (
+	actDROP byte = 0x01
+	actFORW byte = 0x02
+	actBUFF byte = 0x04
+	actNOCP byte = 0x08
+	actDUPL byte = 0x10
+)
+
+// URR of UPF
+type URR struct {
+	ID        uint32    `json:"ID"`
+	Sequence  uint32    `json:"sequence"`
+	Uplink    uint64    `json:"uplink"`
+	Downlink  uint64    `json:"downlink"`
+	ULPackets uint64    `json:"uplinkPackets"`
+	DLPackets uint64    `json:"downlinkPackets"`
+	Start     time.Time `json:"startTime"`
+}
+
+// QER of UPF
+type QER struct {
+	ID  uint32 `json:"ID"`
+	QFI byte   `json:"QFI,omitempty"`
+}
+
+// ruleError is failure of rule creation or modification
+type ruleError struct {
+	cause  byte
+	ieType uint16
+	msg    string
+}
+
+func (e ruleError) Error() string {
+	return e.msg
+}
+
+func handleEstablishment(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var cpid uint64
+	for _, ie := range m.IEs {
+		if ie.IEType == 57 && len(ie.Data) >= 9 {
+			cpid = binary.BigEndian.Uint64(ie.Data[1:])
+		}
+	}
+	zero := uint64(0)
+	n := peerNode(m)
+	if !peers[n] {
+		writeResponse(m, 51, &cpid, func(b *bytes.Buffer) {
+			nodeID(b)
+			encodeCause(72, b)
+		})
+		return
+	}
+
+	t := &session{
+		CPSEID: cpid,
+		Peer:   n,
+		PDR:    make(map[uint16]*PDR),
+		FAR:    make(map[uint32]*FAR),
+		URR:    make(map[uint32]*URR),
+		QER:    make(map[uint32]*QER),
+		MAR:    make(map[uint16]*MAR),
+		SRR:    make(map[byte]*SRR),
+		choose: make(map[byte]uint32),
+		buffer: make(map[uint32][][]byte),
+		peer:   m.peer}
+	if cpid == 0 {
+		writeResponse(m, 51, &zero, func(b *bytes.Buffer) {
+			nodeID(b)
+			encodeCause(66, b)
+			b.Write([]byte{0x00, 0x28, 0x00, 0x02, 0x00, 0x39})
+		})
+		return
+	}
+
+	for _, ie := range m.IEs {
+		if ie.IEType == 65 {
+			t.csidNode, t.CSID = decodeCSID(ie.Data)
+		}
+	}
+	t.userInfo(m.IEs)
+	e := t.apply(m.IEs)
+	if e != nil {
+		log.Printf("Rx PFCP: session establishment failed: %s", e)
+		t.release()
+		re, _ := e.(ruleError)
+		writeResponse(m, 51, &cpid, func(b *bytes.Buffer) {
+			nodeID(b)
+			encodeCause(re.cause, b)
+			if re.ieType != 0 {
+				b.Write([]byte{0x00, 0x28, 0x00, 0x02})
+				binary.Write(b, binary.BigEndian, re.ieType)
+			}
+		})
+		return
+	}
+
+	for {
+		t.SEID = rand.Uint64()
+		if _, ok := sessions[t.SEID]; !ok && t.SEID != 0 {
+			sessions[t.SEID] = t
+			t.ID = strconv.FormatUint(t.SEID, 16)
+			break
+		}
+	}
+	writeResponse(m, 51, &cpid, func(b *bytes.Buffer) {
+		nodeID(b)
+		encodeCause(1, b)
+		sessionID(b, t.SEID)
+		t.createdPDR(b)
+		t.bridgeInfo(m.IEs, b)
+		atsssParameters(m.IEs, b)
+		rdsConfiguration(m.IEs, b)
+	})
+}
+
+func handleModification(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	t, ok := sessions[m.SessionID]
+	if !ok {
+		zero := uint64(0)
+		writeResponse(m, 53, &zero, func(b *bytes.Buffer) {
+			encodeCause(65, b)
+		})
+		return
+	}
+
+	e := t.apply(m.IEs)
+	if e != nil {
+		log.Printf("Rx PFCP: session modification failed: %s", e)
+		re, _ := e.(ruleError)
+		writeResponse(m, 53, &t.CPSEID, func(b *bytes.Buffer) {
+			encodeCause(re.cause, b)
+			if re.ieType != 0 {
+				b.Write([]byte{0x00, 0x28, 0x00, 0x02})
+				binary.Write(b, binary.BigEndian, re.ieType)
+			}
+		})
+		return
+	}
+
+	query := []uint32{}
+	for _, ie := range m.IEs {
+		if ie.IEType != 77 {
+			continue
+		}
+		if ies, e := pfcp.DecodeIEs(ie.Data); e == nil {
+			for _, c := range ies {
+				if c.IEType == 81 && len(c.Data) >= 4 {
+					query = append(query, binary.BigEndian.Uint32(c.Data))
+				}
+			}
+		}
+	}
+
+	writeResponse(m, 53, &t.CPSEID, func(b *bytes.Buffer) {
+		encodeCause(1, b)
+		t.createdPDR(b)
+		for _, id := range query {
+			if u, ok := t.URR[id]; ok {
+				u.report(78, []byte{0x80, 0x00, 0x00}, nil, b)
+			}
+		}
+		tscResponse(m.IEs, b)
+		atsssParameters(m.IEs, b)
+	})
+	for id := range t.FAR {
+		t.flush(id)
+	}
+}
+
+func handleDeletion(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	t, ok := sessions[m.SessionID]
+	if !ok {
+		zero := uint64(0)
+		writeResponse(m, 55, &zero, func(b *bytes.Buffer) {
+			encodeCause(65, b)
+		})
+		return
+	}
+
+	t.release()
+	delete(sessions, t.SEID)
+	writeResponse(m, 55, &t.CPSEID, func(b *bytes.Buffer) {
+		encodeCause(1, b)
+		for _, id := range t.urrIDs() {
+			t.URR[id].report(79, []byte{0x00, 0x08, 0x00}, nil, b)
+		}
+	})
+}
+
+func releaseSessions(node string) {
+	for id, t := range sessions {
+		if t.Peer == node {
+			t.release()
+			delete(sessions, id)
+		}
+	}
+}
+
+func handleSetDeletion(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	n := peerNode(m)
+	var node string
+	var csid []uint16
+	for _, ie := range m.IEs {
+		if ie.IEType == 65 {
+			node, csid = decodeCSID(ie.Data)
+		}
+	}
+
+	c := 0
+	for id, t := range sessions {
+		if t.Peer == n && t.matchCSID(node, csid) {
+			t.release()
+			delete(sessions, id)
+			c++
+		}
+	}
+	log.Printf("Rx PFCP: %d sessions are deleted", c)
+	writeResponse(m, 15, nil, func(b *bytes.Buffer) {
+		nodeID(b)
+		encodeCause(1, b)
+	})
+}
+
+func handleSetModification(m Message) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	var alt net.IP
+	var node string
+	var csid []uint16
+	for _, ie := range m.IEs {
+		switch ie.IEType {
+		case 178:
+			if len(ie.Data) >= 5 && ie.Data[0]&0x02 == 0x02 {
+				alt = net.IP(ie.Data[1:5])
+			} else if len(ie.Data) >= 17 && ie.Data[0]&0x01 == 0x01 {
+				alt = net.IP(ie.Data[1:17])
+			}
+		case 65:
+			node, csid = decodeCSID(ie.Data)
+		}
+	}
+	if alt == nil {
+		writeResponse(m, 17, nil, func(b *bytes.Buffer) {
+			nodeID(b)
+			encodeCause(66, b)
+			b.Write([]byte{0x00, 0x28, 0x00, 0x02, 0x00, 0xb2})
+		})
+		return
+	}
+
+	c := 0
+	for _, t := range sessions {
+		if t.peer.IP.Equal(m.peer.IP) && t.matchCSID(node, csid) {
+			t.peer = &net.UDPAddr{IP: alt, Port: t.peer.Port}
+			c++
+		}
+	}
+	log.Printf("Rx PFCP: %d sessions are moved to %s", c, alt)
+	writeResponse(m, 17, nil, func(b *bytes.Buffer) {
+		nodeID(b)
+		encodeCause(1, b)
+	})
+}
+
+// decodeCSID returns node address and CSIDs of FQ-CSID IE
+func decodeCSID(b []byte) (node string, csid []uint16) {
+	if len(b) == 0 {
+		return
+	}
+	l := [3]int{4, 16, 4}
+	if int(b[0]>>4) >= len(l) || len(b) < 1+l[b[0]>>4]+2*int(b[0]&0x0f) {
+		return
+	}
+	node = fmt.Sprintf("%x", b[1:1+l[b[0]>>4]])
+	for d := b[1+l[b[0]>>4]:]; len(csid) < int(b[0]&0x0f); d = d[2:] {
+		csid = append(csid, binary.BigEndian.Uint16(d))
+	}
+	return
+}
+
+// matchCSID returns true if the session has any of csid in the node,
+// or csid is empty.
+func (t *session) matchCSID(node string, csid []uint16) bool {
+	if len(node) == 0 {
+		return true
+	}
+	if node != t.csidNode {
+		return false
+	}
+	for _, i := range csid {
+		for _, j := range t.CSID {
+			if i == j {
+				return true
+			}
+		}
+	}
+	return len(csid) == 0
+}
+
+func (t *session) release() {
+	for _, p := range t.PDR {
+		t.unindex(p)
+	}
+}
+
+func (t *session) index(p *PDR) {
+	if p.TEID != 0 {
+		teids[p.TEID] = t
+	}
+	if p.RedundantTEID != 0 {
+		teids[p.RedundantTEID] = t
+	}
+	if p.UEIP != nil {
+		ueips[p.UEIP.String()] = t
+	}
+}
+
+func (t *session) unindex(p *PDR) {
+	if p.TEID != 0 && teids[p.TEID] == t {
+		delete(teids, p.TEID)
+	}
+	if p.RedundantTEID != 0 && teids[p.RedundantTEID] == t {
+		delete(teids, p.RedundantTEID)
+	}
+	if p.UEIP != nil && ueips[p.UEIP.String()] == t {
+		delete(ueips, p.UEIP.String())
+	}
+}
+
+func (t *session) urrIDs() []uint32 {
+	ids := make([]uint32, 0, len(t.URR))
+	for id := range t.URR {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// apply Create, Update and Remove rule IEs to the session
+func (t *session) apply(ies []IE) error {
+	for _, ie := range ies {
+		var e error
+		switch ie.IEType {
+		case 1, 9:
+			e = t.applyPDR(ie.IEType, ie.Data)
+		case 3, 10:
+			e = t.applyFAR(ie.IEType, ie.Data)
+		case 6, 13:
+			var id uint32
+			if id, e = ruleID(ie.Data, 81); e == nil {
+				if _, ok := t.URR[id]; !ok {
+					t.URR[id] = &URR{ID: id, Start: time.Now()}
+				}
+			}
+		case 7, 14:
+			var id uint32
+			if id, e = ruleID(ie.Data, 109); e == nil {
+				q := &QER{ID: id}
+				if o, ok := t.QER[id]; ok {
+					q = o
+				}
+				var c []IE
+				c, e = pfcp.DecodeIEs(ie.Data)
+				for _, i := range c {
+					if i.IEType == 124 && len(i.Data) != 0 {
+						q.QFI = i.Data[0] & 0x3f
+					}
+				}
+				t.QER[id] = q
+			}
+		case 15:
+			var c []IE
+			if c, e = pfcp.DecodeIEs(ie.Data); e == nil && len(c) != 0 &&
+				c[0].IEType == 56 && len(c[0].Data) >= 2 {
+				id := binary.BigEndian.Uint16(c[0].Data)
+				if p, ok := t.PDR[id]; ok {
+					t.unindex(p)
+					delete(t.PDR, id)
+				} else {
+					e = unknownRule("PDR", uint32(id))
+				}
+			}
+		case 16:
+			var id uint32
+			if id, e = ruleID(ie.Data, 108); e != nil {
+				break
+			}
+			if _, ok := t.FAR[id]; !ok {
+				e = unknownRule("FAR", id)
+				break
+			}
+			delete(t.FAR, id)
+			delete(t.buffer, id)
+		case 17:
+			var id uint32
+			if id, e = ruleID(ie.Data, 81); e != nil {
+				break
+			}
+			if _, ok := t.URR[id]; !ok {
+				e = unknownRule("URR", id)
+				break
+			}
+			delete(t.URR, id)
+		case 18:
+			var id uint32
+			if id, e = ruleID(ie.Data, 109); e != nil {
+				break
+			}
+			if _, ok := t.QER[id]; !ok {
+				e = unknownRule("QER", id)
+				break
+			}
+			delete(t.QER, id)
+		case 165, 169:
+			e = t.applyMAR(ie.IEType, ie.Data)
+		case 168:
+			e = t.removeMAR(ie.Data)
+		case 212, 213:
+			e = t.applySRR(ie.IEType, ie.Data)
+		case 211:
+			e = t.removeSRR(ie.Data)
+		}
+		if e != nil {
+			if _, ok := e.(ruleError); !ok {
+				e = ruleError{cause: 69, ieType: ie.IEType, msg: e.Error()}
+			}
+			return e
+		}
+	}
+
+	for _, p := range t.PDR {
+		if _, ok := t.FAR[p.FAR]; !ok && p.FAR != 0 {
+			return ruleError{cause: 73, ieType: 108,
+				msg: fmt.Sprintf("unknown FAR %d in PDR %d", p.FAR, p.ID)}
+		}
+	}
+	return t.checkMAR()
+}
+
+func unknownRule(r string, id uint32) error {
+	return ruleError{cause: 73, msg: fmt.Sprintf("unknown %s %d", r, id)}
+}
+
+func ruleID(b []byte, t uint16) (uint32, error) {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return 0, e
+	}
+	for _, ie := range ies {
+		if ie.IEType == t && len(ie.Data) >= 4 {
+			return binary.BigEndian.Uint32(ie.Data), nil
+		}
+	}
+	return 0, ruleError{cause: 66, ieType: t,
+		msg: fmt.Sprintf("rule ID IE %d is missing", t)}
+}
+
+func (t *session) applyPDR(typ uint16, b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	var p *PDR
+	for _, ie := range ies {
+		if ie.IEType == 56 && len(ie.Data) >= 2 {
+			id := binary.BigEndian.Uint16(ie.Data)
+			if o, ok := t.PDR[id]; ok {
+				p = o
+			} else if typ == 1 {
+				p = &PDR{ID: id}
+			}
+		}
+	}
+	if p == nil {
+		return ruleError{cause: 66, ieType: 56, msg: "unknown PDR ID"}
+	}
+
+	t.unindex(p)
+	var urr, qer []uint32
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 29:
+			if len(ie.Data) >= 4 {
+				p.Precedence = binary.BigEndian.Uint32(ie.Data)
+			}
+		case 2:
+			if e = t.applyPDI(p, ie.Data); e != nil {
+				return e
+			}
+		case 95:
+			p.Removal = true
+		case 108:
+			if len(ie.Data) >= 4 {
+				p.FAR = binary.BigEndian.Uint32(ie.Data)
+			}
+		case 81:
+			if len(ie.Data) >= 4 {
+				urr = append(urr, binary.BigEndian.Uint32(ie.Data))
+			}
+		case 109:
+			if len(ie.Data) >= 4 {
+				qer = append(qer, binary.BigEndian.Uint32(ie.Data))
+			}
+		case 170:
+			if len(ie.Data) >= 2 {
+				p.MAR = binary.BigEndian.Uint16(ie.Data)
+			}
+		}
+	}
+	if urr != nil {
+		p.URR = urr
+	}
+	if qer != nil {
+		p.QER = qer
+	}
+	t.PDR[p.ID] = p
+	t.index(p)
+	return nil
+}
+
+func (t *session) applyPDI(p *PDR, b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 20:
+			if len(ie.Data) != 0 {
+				p.Source = ie.Data[0] & 0x0f
+			}
+		case 124:
+			if len(ie.Data) != 0 {
+				p.QFI = ie.Data[0] & 0x3f
+			}
+		case 24:
+			p.AppID = string(ie.Data)
+		case 21:
+			if p.TEID, e = t.localTEID(p, ie.Data); e != nil {
+				return e
+			}
+		case 255:
+			var c []IE
+			if c, e = pfcp.DecodeIEs(ie.Data); e != nil {
+				return e
+			}
+			for _, i := range c {
+				if i.IEType != 21 {
+					continue
+				}
+				if p.RedundantTEID, e = t.localTEID(p, i.Data); e != nil {
+					return e
+				}
+				if p.elim == nil {
+					p.elim = &gtpu.Eliminator{}
+				}
+			}
+		case 93:
+			if len(ie.Data) < 1 {
+				return fmt.Errorf("invalid UE IP address")
+			}
+			switch {
+			case ie.Data[0]&0x10 == 0x10:
+				ip, e := allocUEIP()
+				if e != nil {
+					return ruleError{cause: 74, ieType: 93, msg: e.Error()}
+				}
+				p.UEIP = ip
+				p.created = true
+			case ie.Data[0]&0x02 == 0x02 && len(ie.Data) >= 5:
+				p.UEIP = net.IP(ie.Data[1:5])
+			case ie.Data[0]&0x01 == 0x01 && len(ie.Data) >= 17:
+				p.UEIP = net.IP(ie.Data[1:17])
+			}
+		}
+	}
+	return nil
+}
+
+// localTEID returns TEID of the F-TEID IE, new TEID is allocated if CHOOSE
+func (t *session) localTEID(p *PDR, b []byte) (uint32, error) {
+	if len(b) < 1 {
+		return 0, fmt.Errorf("invalid F-TEID")
+	}
+	if b[0]&0x04 == 0x00 {
+		if len(b) < 5 {
+			return 0, fmt.Errorf("invalid F-TEID")
+		}
+		return binary.BigEndian.Uint32(b[1:]), nil
+	}
+	var ch byte
+	if b[0]&0x08 == 0x08 && len(b) > 1 {
+		ch = b[1]
+	}
+	p.created = true
+	if id, ok := t.choose[ch]; ok && ch != 0 {
+		return id, nil
+	}
+	var id uint32
+	for {
+		id = rand.Uint32()
+		if _, ok := teids[id]; !ok && id != 0 && id != p.TEID {
+			break
+		}
+	}
+	if ch != 0 {
+		t.choose[ch] = id
+	}
+	return id, nil
+}
+
+func allocUEIP() (net.IP, error) {
+	base := uePool.IP.To4()
+	if base == nil {
+		return nil, fmt.Errorf("UE IP pool is not IPv4")
+	}
+	ones, bits := uePool.Mask.Size()
+	n := uint32(1) << uint(bits-ones)
+	b := binary.BigEndian.Uint32(base)
+	for i := uint32(1); i+1 < n; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, b+i)
+		if _, ok := ueips[ip.String()]; !ok {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("no free UE IP address")
+}
+
+func (t *session) applyFAR(typ uint16, b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	var f *FAR
+	for _, ie := range ies {
+		if ie.IEType == 108 && len(ie.Data) >= 4 {
+			id := binary.BigEndian.Uint32(ie.Data)
+			if o, ok := t.FAR[id]; ok {
+				f = o
+			} else if typ == 3 {
+				f = &FAR{ID: id}
+			}
+		}
+	}
+	if f == nil {
+		return ruleError{cause: 66, ieType: 108, msg: "unknown FAR ID"}
+	}
+
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 44:
+			if len(ie.Data) != 0 {
+				f.Action = ie.Data[0]
+			}
+			if f.Action&actBUFF == 0 {
+				t.notify = false
+			}
+		case 4, 11, 270:
+			var c []IE
+			if c, e = pfcp.DecodeIEs(ie.Data); e != nil {
+				return e
+			}
+			for _, i := range c {
+				switch i.IEType {
+				case 42:
+					if len(i.Data) != 0 {
+						f.Dest = i.Data[0] & 0x0f
+					}
+				case 84:
+					if len(i.Data) < 6 {
+						return fmt.Errorf("invalid outer header creation")
+					}
+					teid, ip := binary.BigEndian.Uint32(i.Data[2:]), net.IP(nil)
+					if i.Data[0]&0x01 == 0x01 && len(i.Data) >= 10 {
+						ip = net.IP(i.Data[6:10])
+					} else if i.Data[0]&0x02 == 0x02 && len(i.Data) >= 22 {
+						ip = net.IP(i.Data[6:22])
+					}
+					if ie.IEType == 270 {
+						f.RedundantTEID, f.RedundantIP = teid, ip
+					} else {
+						f.TEID, f.IP = teid, ip
+					}
+				}
+			}
+		}
+	}
+	t.FAR[f.ID] = f
+	return nil
+}
+
+// createdPDR writes Created PDR IEs of allocated F-TEID or UE IP
+func (t *session) createdPDR(b *bytes.Buffer) {
+	for _, p := range t.PDR {
+		if !p.created {
+			continue
+		}
+		p.created = false
+
+		buf := new(bytes.Buffer)
+		buf.Write([]byte{0x00, 0x38, 0x00, 0x02})
+		binary.Write(buf, binary.BigEndian, p.ID)
+		// second F-TEID is Local F-TEID for Redundant Transmission
+		for _, teid := range []uint32{p.TEID, p.RedundantTEID} {
+			if teid == 0 || p.Source != 0 {
+				continue
+			}
+			if ip := gtpAddr.IP.To4(); ip != nil {
+				buf.Write([]byte{0x00, 0x15, 0x00, 0x09, 0x01})
+				binary.Write(buf, binary.BigEndian, teid)
+				buf.Write(ip)
+			} else {
+				buf.Write([]byte{0x00, 0x15, 0x00, 0x15, 0x02})
+				binary.Write(buf, binary.BigEndian, teid)
+				buf.Write(gtpAddr.IP.To16())
+			}
+		}
+		if ip := p.UEIP.To4(); ip != nil {
+			buf.Write([]byte{0x00, 0x5d, 0x00, 0x05, 0x02})
+			buf.Write(ip)
+		}
+
+		b.Write([]byte{0x00, 0x08})
+		binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+		buf.WriteTo(b)
+	}
+}
+
+// report writes Usage Report IE of type t.
+// adi is Application Detection Information IE which is added if not nil.
+func (u *URR) report(t uint16, trigger, adi []byte, b *bytes.Buffer) {
+	now := time.Now()
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0x00, 0x51, 0x00, 0x04})
+	binary.Write(buf, binary.BigEndian, u.ID)
+	buf.Write([]byte{0x00, 0x68, 0x00, 0x04})
+	binary.Write(buf, binary.BigEndian, u.Sequence)
+	buf.Write([]byte{0x00, 0x3f, 0x00, byte(len(trigger))})
+	buf.Write(trigger)
+	buf.Write([]byte{0x00, 0x4b, 0x00, 0x04})
+	encodeTime(u.Start, buf)
+	buf.Write([]byte{0x00, 0x4c, 0x00, 0x04})
+	encodeTime(now, buf)
+	buf.Write([]byte{0x00, 0x42, 0x00, 0x31, 0x3f})
+	for _, v := range []uint64{
+		u.Uplink + u.Downlink, u.Uplink, u.Downlink,
+		u.ULPackets + u.DLPackets, u.ULPackets, u.DLPackets} {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	buf.Write(adi)
+
+	binary.Write(b, binary.BigEndian, t)
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+
+	u.Sequence++
+	u.Start = now
+	u.Uplink, u.Downlink, u.ULPackets, u.DLPackets = 0, 0, 0, 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// SRR of UPF
+type SRR struct {
+	ID        byte      `json:"ID"`
+	QFI       []int     `json:"QFI,omitempty"`
+	Requested byte      `json:"requestedQoSMonitoring,omitempty"`
+	Start     time.Time `json:"startTime"`
+}
+
+// QoSMonitoring is measured packet delays in millisecond of QoS Monitoring Report
+type QoSMonitoring struct {
+	SRR byte    `json:"SRR"`
+	DL  *uint32 `json:"downlinkDelay,omitempty"`
+	UL  *uint32 `json:"uplinkDelay,omitempty"`
+	RP  *uint32 `json:"roundTripDelay,omitempty"`
+}
+
+func (t *session) applySRR(typ uint16, b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	var r *SRR
+	for _, ie := range ies {
+		if ie.IEType == 215 && len(ie.Data) >= 1 {
+			if o, ok := t.SRR[ie.Data[0]]; ok {
+				r = o
+			} else if typ == 212 {
+				r = &SRR{ID: ie.Data[0], Start: time.Now()}
+			} else {
+				return unknownRule("SRR", uint32(ie.Data[0]))
+			}
+		}
+	}
+	if r == nil {
+		return ruleError{cause: 66, ieType: 215, msg: "SRR ID is missing"}
+	}
+
+	var qfi []int
+	for _, ie := range ies {
+		if ie.IEType != 242 {
+			continue
+		}
+		var c []IE
+		if c, e = pfcp.DecodeIEs(ie.Data); e != nil {
+			return e
+		}
+		for _, i := range c {
+			switch i.IEType {
+			case 124:
+				if len(i.Data) != 0 {
+					qfi = append(qfi, int(i.Data[0]&0x3f))
+				}
+			case 243:
+				if len(i.Data) != 0 {
+					r.Requested = i.Data[0] & 0x07
+				}
+			}
+		}
+	}
+	if qfi != nil {
+		r.QFI = qfi
+	}
+	t.SRR[r.ID] = r
+	return nil
+}
+
+func (t *session) removeSRR(b []byte) error {
+	ies, e := pfcp.DecodeIEs(b)
+	if e != nil {
+		return e
+	}
+	for _, ie := range ies {
+		if ie.IEType != 215 || len(ie.Data) < 1 {
+			continue
+		}
+		if _, ok := t.SRR[ie.Data[0]]; !ok {
+			return unknownRule("SRR", uint32(ie.Data[0]))
+		}
+		delete(t.SRR, ie.Data[0])
+		return nil
+	}
+	return ruleError{cause: 66, ieType: 215, msg: "SRR ID is missing"}
+}
+
+// report writes Session Report IE with QoS Monitoring Report of each QFI
+func (q QoSMonitoring) report(r *SRR, b *bytes.Buffer) {
+	now := time.Now()
+	m := new(bytes.Buffer)
+	var f byte
+	for i, v := range []*uint32{q.DL, q.UL, q.RP} {
+		if v != nil {
+			f = f | 0x01<<uint(i)
+			binary.Write(m, binary.BigEndian, *v)
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{0x00, 0xd7, 0x00, 0x01, r.ID})
+	for _, qfi := range r.QFI {
+		buf.Write([]byte{0x00, 0xf7})
+		binary.Write(buf, binary.BigEndian, uint16(5+4+m.Len()+1+8+8))
+		buf.Write([]byte{0x00, 0x7c, 0x00, 0x01, byte(qfi)})
+		buf.Write([]byte{0x00, 0xf8})
+		binary.Write(buf, binary.BigEndian, uint16(m.Len()+1))
+		buf.WriteByte(f)
+		buf.Write(m.Bytes())
+		buf.Write([]byte{0x00, 0x9c, 0x00, 0x04})
+		encodeTime(now, buf)
+		buf.Write([]byte{0x00, 0x4b, 0x00, 0x04})
+		encodeTime(r.Start, buf)
+	}
+	r.Start = now
+
+	b.Write([]byte{0x00, 0xd6})
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+func (q QoSMonitoring) validate(t *session) error {
+	if _, ok := t.SRR[q.SRR]; !ok {
+		return fmt.Errorf("unknown SRR %d", q.SRR)
+	}
+	if q.DL == nil && q.UL == nil && q.RP == nil {
+		return fmt.Errorf("no packet delay")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// last allocated DS-TT port number
+var dsttPort uint32
+
+// TSCManagement is TSC Management Information of Session Report.
+// Containers are hex string of octets.
+type TSCManagement struct {
+	PortManagement   string `json:"portManagementContainer,omitempty"`
+	BridgeManagement string `json:"bridgeManagementContainer,omitempty"`
+	NWTTPort         uint32 `json:"NWTTPortNumber,omitempty"`
+}
+
+func (i TSCManagement) validate() error {
+	if _, e := hex.DecodeString(i.PortManagement); e != nil {
+		return fmt.Errorf("invalid port management container: %s", e)
+	}
+	if _, e := hex.DecodeString(i.BridgeManagement); e != nil {
+		return fmt.Errorf("invalid bridge management container: %s", e)
+	}
+	return nil
+}
+
+func (i TSCManagement) encode(t uint16, b *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	if data, e := hex.DecodeString(i.PortManagement); e == nil && len(data) != 0 {
+		buf.Write([]byte{0x00, 0xca})
+		binary.Write(buf, binary.BigEndian, uint16(len(data)))
+		buf.Write(data)
+	}
+	if data, e := hex.DecodeString(i.BridgeManagement); e == nil && len(data) != 0 {
+		buf.Write([]byte{0x01, 0x0a})
+		binary.Write(buf, binary.BigEndian, uint16(len(data)))
+		buf.Write(data)
+	}
+	if i.NWTTPort != 0 {
+		buf.Write([]byte{0x00, 0xc5, 0x00, 0x04})
+		binary.Write(buf, binary.BigEndian, i.NWTTPort)
+	}
+	binary.Write(b, binary.BigEndian, t)
+	binary.Write(b, binary.BigEndian, uint16(buf.Len()))
+	buf.WriteTo(b)
+}
+
+// bridgeInfo writes Created Bridge Info for TSC IE with new DS-TT port
+// if Create Bridge Info for TSC IE requests it.
+// TSN bridge ID is the N3 address of the UPF.
+func (t *session) bridgeInfo(ies []IE, b *bytes.Buffer) {
+	for _, ie := range ies {
+		if ie.IEType != 194 || len(ie.Data) == 0 || ie.Data[0]&0x01 == 0 {
+			continue
+		}
+		dsttPort++
+		t.DSTTPort = dsttPort
+
+		b.Write([]byte{0x00, 0xc3, 0x00, 0x15, 0x00, 0xc4, 0x00, 0x04})
+		binary.Write(b, binary.BigEndian, t.DSTTPort)
+		b.Write([]byte{0x00, 0xc6, 0x00, 0x09, 0x01})
+		b.Write(gtpAddr.IP.To16()[8:])
+		return
+	}
+}
+
+// tscResponse writes TSC Management Information IE of modification response
+// which has the same containers as the request.
+func tscResponse(ies []IE, b *bytes.Buffer) {
+	for _, ie := range ies {
+		if ie.IEType != 199 {
+			continue
+		}
+		b.Write([]byte{0x00, 0xc8})
+		binary.Write(b, binary.BigEndian, uint16(len(ie.Data)))
+		b.Write(ie.Data)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/fkgi/harico/pfcp"
+)
+
+// UserID of the session, IMSI, IMEI and MSISDN are digit strings
+type UserID struct {
+	IMSI   string `json:"IMSI,omitempty"`
+	IMEI   string `json:"IMEI,omitempty"`
+	MSISDN string `json:"MSISDN,omitempty"`
+	NAI    string `json:"NAI,omitempty"`
+	SUPI   string `json:"SUPI,omitempty"`
+	GPSI   string `json:"GPSI,omitempty"`
+}
+
+// userInfo sets User ID and trace reference of Trace Information
+// in ies to the session
+func (t *session) userInfo(ies []IE) {
+	for _, ie := range ies {
+		switch ie.IEType {
+		case 141:
+			if len(ie.Data) == 0 {
+				break
+			}
+			u := &UserID{}
+			f, b := ie.Data[0], ie.Data[1:]
+			for i, v := range []*string{
+				&u.IMSI, &u.IMEI, &u.MSISDN, &u.NAI, &u.SUPI, &u.GPSI} {
+				if f&(0x01<<uint(i)) == 0 {
+					continue
+				}
+				if len(b) < 1 || len(b) < int(b[0])+1 {
+					return
+				}
+				l := int(b[0])
+				if i < 3 {
+					*v = decodeTBCD(b[1 : l+1])
+				} else {
+					*v = string(b[1 : l+1])
+				}
+				b = b[l+1:]
+			}
+			t.UserID = u
+		case 152:
+			if len(ie.Data) < 6 {
+				break
+			}
+			// trace reference is MCC-MNC-TraceID
+			d := ie.Data
+			t.Trace = fmt.Sprintf("%s-%s-%s",
+				decodeTBCD([]byte{d[0], d[1]&0x0f | 0xf0}),
+				decodeTBCD([]byte{d[2], d[1]>>4 | 0xf0}),
+				hex.EncodeToString(d[3:6]))
+		}
+	}
+}
+
+func decodeTBCD(b []byte) string {
+	s := make([]byte, 0, len(b)*2)
+	for _, o := range b {
+		for _, d := range []byte{o & 0x0f, o >> 4} {
+			if d > 9 {
+				return string(s)
+			}
+			s = append(s, '0'+d)
+		}
+	}
+	return string(s)
+}
+
+// rdsConfiguration writes RDS configuration information IE with RDS flag
+// if Provide RDS configuration information IE requests it.
+func rdsConfiguration(ies []IE, b *bytes.Buffer) {
+	for _, ie := range ies {
+		if ie.IEType != 261 {
+			continue
+		}
+		c, e := pfcp.DecodeIEs(ie.Data)
+		if e != nil {
+			return
+		}
+		for _, i := range c {
+			if i.IEType == 262 && len(i.Data) != 0 && i.Data[0]&0x01 == 0x01 {
+				b.Write([]byte{0x01, 0x06, 0x00, 0x01, 0x01})
+				return
+			}
+		}
+	}
+}